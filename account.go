@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"hungries-api/dao"
+)
+
+// link code is typed on another device right after it's shown
+const accountLinkCodeLifetime = 15 * time.Minute
+
+var ErrAccountNotFound = errors.New("account not found")
+var ErrDeviceLinked = errors.New("device is linked to another account")
+
+// GetAccount get account the device is linked to
+func GetAccount(deviceId string) (AccountResponse, error) {
+	account, err := Dao.AccountsDB.GetAccountByDevice(deviceId)
+	if err != nil {
+		return AccountResponse{}, err
+	}
+	if account == nil {
+		return AccountResponse{}, ErrAccountNotFound
+	}
+	return accountToResponse(*account), nil
+}
+
+// CreateAccount create account for the device, existing account is returned if the device has one already.
+// A new link code is issued every time, it's returned only here
+func CreateAccount(deviceId string) (AccountResponse, error) {
+	account, err := Dao.AccountsDB.GetAccountByDevice(deviceId)
+	if err != nil {
+		return AccountResponse{}, err
+	}
+	if account == nil {
+		account, err = Dao.AccountsDB.CreateAccount(deviceId)
+		if err != nil {
+			return AccountResponse{}, err
+		}
+	}
+	linkCode, err := Dao.AccountsDB.RotateLinkCode(account.Id, accountLinkCodeLifetime)
+	if err != nil {
+		return AccountResponse{}, err
+	}
+	response := accountToResponse(*account)
+	response.LinkCode = linkCode
+	return response, nil
+}
+
+// LinkDevice link device to account by link code and merge likes of the device into the account,
+// the code can't be used again
+func LinkDevice(deviceId string, linkCode string) (AccountResponse, error) {
+	account, err := Dao.AccountsDB.GetAccountByLinkCode(linkCode)
+	if err != nil {
+		return AccountResponse{}, err
+	}
+	if account == nil {
+		return AccountResponse{}, ErrAccountNotFound
+	}
+	linkedAccount, err := Dao.AccountsDB.GetAccountByDevice(deviceId)
+	if err != nil {
+		return AccountResponse{}, err
+	}
+	if linkedAccount != nil {
+		if linkedAccount.Id != account.Id {
+			return AccountResponse{}, ErrDeviceLinked
+		}
+		return accountToResponse(*linkedAccount), nil
+	}
+	accountId, err := Dao.AccountsDB.LinkDeviceByCode(deviceId, linkCode)
+	if err != nil {
+		return AccountResponse{}, err
+	}
+	// code was used up by another device meanwhile
+	if accountId == 0 {
+		return AccountResponse{}, ErrAccountNotFound
+	}
+	log.WithFields(log.Fields{
+		"deviceId":  deviceId,
+		"accountId": accountId,
+	}).Info("Device linked to account")
+	return GetAccount(deviceId)
+}
+
+func accountToResponse(account dao.AccountDB) AccountResponse {
+	return AccountResponse{
+		Id:      account.Id,
+		Devices: account.Devices,
+	}
+}
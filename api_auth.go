@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"hungries-api/dao"
+)
+
+// ScopeReadPlaces search places and read likes, sessions and accounts
+const ScopeReadPlaces = "places:read"
+
+// ScopeWriteLikes save likes and change sessions and accounts
+const ScopeWriteLikes = "likes:write"
+
+// ScopeAdmin manage API clients, grants all other scopes
+const ScopeAdmin = "admin"
+
+var apiScopes = []string{ScopeReadPlaces, ScopeWriteLikes, ScopeAdmin}
+
+const ApiKeyHeader = "X-API-Key"
+
+// bootstrap client created from $ADMIN_API_KEY
+const adminClientName = "admin"
+
+// legacy client authenticated with shared Basic Auth credentials
+const legacyClientName = "legacy-basic-auth"
+
+const apiKeyPrefix = "hk_"
+const apiKeyBytes = 32
+
+type contextKey string
+
+const apiClientContextKey contextKey = "apiClient"
+
+// ApiAuth checks API keys of clients, shared Basic Auth credentials are accepted too when they are enabled
+// until LegacyUntil, so already released apps keep working until they move to API keys
+type ApiAuth struct {
+	LegacyUsername string
+	LegacyPassword string
+	// LegacyUntil sunset of Basic Auth, zero when it's disabled
+	LegacyUntil time.Time
+	// DeviceTokens checks device tokens of requests, nil when device tokens are disabled
+	DeviceTokens *DeviceTokens
+	// RateLimiter limits requests of clients and devices, nil when there are no limits
+	RateLimiter *RateLimiter
+	// ClientIpHeader header with client IP address set by a trusted load balancer, e.g. X-Forwarded-For,
+	// remote address of the connection is used when it's empty
+	ClientIpHeader string
+}
+
+// Require allow request only for clients with scope and attach client to request context.
+// Device token of the request must be issued to the device in path or query
+func (a *ApiAuth) Require(handler http.HandlerFunc, scope string) http.HandlerFunc {
+	return a.require(handler, scope, true)
+}
+
+// RequireClient same as Require without device token check, for requests that manage device tokens themselves
+func (a *ApiAuth) RequireClient(handler http.HandlerFunc, scope string) http.HandlerFunc {
+	return a.require(handler, scope, false)
+}
+
+func (a *ApiAuth) require(handler http.HandlerFunc, scope string, checkDevice bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := a.authenticate(r)
+		if err != nil {
+			log.WithField("error", err).Error("Error authenticating api client")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if client == nil || !client.IsActive(time.Now()) {
+			if a.isLegacyEnabled(time.Now()) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="Hungries API"`)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if client.Name == legacyClientName {
+			log.WithFields(log.Fields{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"sunset": a.LegacyUntil,
+			}).Warn("Legacy Basic Auth request, the app must move to API keys")
+			w.Header().Set("Sunset", a.LegacyUntil.UTC().Format(http.TimeFormat))
+		}
+		if !hasScope(client.Scopes, scope) {
+			log.WithFields(log.Fields{
+				"client": client.Name,
+				"scope":  scope,
+			}).Warn("Api client is missing scope")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), apiClientContextKey, client)
+		if checkDevice && a.DeviceTokens != nil {
+			deviceId, err := a.DeviceTokens.checkRequestDevice(r)
+			if err == ErrInvalidDeviceToken {
+				log.WithField("client", client.Name).Warn("Invalid device token")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				log.WithField("error", err).Error("Error checking device token")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			ctx = context.WithValue(ctx, deviceContextKey, deviceId)
+		}
+		if a.RateLimiter != nil {
+			deviceId := DeviceFromContext(ctx)
+			if deviceId == "" {
+				deviceId = getRequestDevice(r)
+			}
+			isAllowed, err := a.RateLimiter.Allow(a.rateLimitClientKey(client.Name, deviceId, r), deviceId)
+			if err != nil {
+				// limiter failure shouldn't take the API down
+				log.WithField("error", err).Error("Error checking rate limit")
+			} else if !isAllowed {
+				log.WithFields(log.Fields{
+					"client":   client.Name,
+					"deviceId": deviceId,
+				}).Warn("Request is rate limited")
+				w.Header().Set("Retry-After", a.RateLimiter.RetryAfter())
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		log.WithFields(log.Fields{
+			"client": client.Name,
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Debug("Api request")
+		handler(w, r.WithContext(ctx))
+	}
+}
+
+// authenticate find client by API key header or legacy Basic Auth, nil if credentials are missing or wrong
+// or Basic Auth is disabled or past its sunset
+func (a *ApiAuth) authenticate(r *http.Request) (*dao.ApiClientDB, error) {
+	if key := r.Header.Get(ApiKeyHeader); key != "" {
+		return Dao.ApiClientsDB.GetClientByKeyHash(hashApiKey(key))
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok || !a.isLegacyEnabled(time.Now()) ||
+		subtle.ConstantTimeCompare([]byte(user), []byte(a.LegacyUsername)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(pass), []byte(a.LegacyPassword)) != 1 {
+		return nil, nil
+	}
+	return &dao.ApiClientDB{
+		Name:   legacyClientName,
+		Scopes: []string{ScopeReadPlaces, ScopeWriteLikes},
+	}, nil
+}
+
+// isLegacyEnabled check if Basic Auth is configured and its sunset hasn't come yet
+func (a *ApiAuth) isLegacyEnabled(now time.Time) bool {
+	return a.LegacyUsername != "" && a.LegacyPassword != "" && now.Before(a.LegacyUntil)
+}
+
+// rateLimitClientKey rate limit key of the client, apps sharing legacy Basic Auth credentials are told apart
+// by device or by IP address, so one of them can't use up the limit of all of them
+func (a *ApiAuth) rateLimitClientKey(clientName string, deviceId string, r *http.Request) string {
+	if clientName != legacyClientName {
+		return clientName
+	}
+	if deviceId != "" {
+		return clientName + ":device:" + deviceId
+	}
+	return clientName + ":ip:" + a.clientIp(r)
+}
+
+// clientIp address of the client, taken from ClientIpHeader when it's set. The load balancer appends the address
+// it sees to the header, so the last one is used, the earlier ones are sent by the client
+func (a *ApiAuth) clientIp(r *http.Request) string {
+	if a.ClientIpHeader != "" {
+		values := strings.Split(r.Header.Get(a.ClientIpHeader), ",")
+		if ip := strings.TrimSpace(values[len(values)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ApiClientFromContext client that made the request, nil for requests without authentication
+func ApiClientFromContext(ctx context.Context) *dao.ApiClientDB {
+	client, _ := ctx.Value(apiClientContextKey).(*dao.ApiClientDB)
+	return client
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func isKnownScope(scope string) bool {
+	for _, s := range apiScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func generateApiKey() (string, error) {
+	key := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// CreateApiClient create client with new random key, the key is returned only once
+func CreateApiClient(name string, scopes []string, expireDate time.Time) (ApiClientResponse, error) {
+	key, err := generateApiKey()
+	if err != nil {
+		return ApiClientResponse{}, err
+	}
+	client, err := Dao.ApiClientsDB.CreateClient(name, hashApiKey(key), scopes,
+		sql.NullTime{Time: expireDate, Valid: !expireDate.IsZero()})
+	if err != nil {
+		return ApiClientResponse{}, err
+	}
+	response := apiClientToResponse(*client)
+	response.Key = key
+	return response, nil
+}
+
+// GetApiClients get all clients without their keys
+func GetApiClients() ([]ApiClientResponse, error) {
+	clients, err := Dao.ApiClientsDB.GetClients()
+	if err != nil {
+		return nil, err
+	}
+	result := []ApiClientResponse{}
+	for _, client := range clients {
+		result = append(result, apiClientToResponse(client))
+	}
+	return result, nil
+}
+
+// bootstrapAdminClient save admin client with key from environment, so the first clients can be created
+func bootstrapAdminClient(key string) error {
+	return Dao.ApiClientsDB.SaveClientKey(adminClientName, hashApiKey(key), []string{ScopeAdmin})
+}
+
+func apiClientToResponse(client dao.ApiClientDB) ApiClientResponse {
+	var expiresAt *time.Time
+	if client.ExpireDate.Valid {
+		expiresAt = &client.ExpireDate.Time
+	}
+	return ApiClientResponse{
+		Id:        client.Id,
+		Name:      client.Name,
+		Scopes:    client.Scopes,
+		ExpiresAt: expiresAt,
+		IsRevoked: client.IsRevoked,
+		CreatedAt: client.CreateDate,
+	}
+}
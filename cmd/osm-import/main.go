@@ -0,0 +1,153 @@
+// Command osm-import loads restaurants, cafes and bars from an Overpass API JSON extract
+// or an OSM PBF extract (files ending with .pbf) into hungries.place.
+//
+// Overpass extract can be downloaded with a query like
+//
+//	[out:json];
+//	nwr["amenity"~"^(restaurant|cafe|bar|pub|fast_food)$"]({{bbox}});
+//	out center;
+//
+// Usage:
+//
+//	DATABASE_URL=postgres://... osm-import extract.json
+//	DATABASE_URL=postgres://... osm-import region-latest.osm.pbf
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"hungries-api/dao"
+)
+
+// number of places saved in one insert
+const batchSize = 500
+
+// imported OSM amenities and matching Google place types
+var importedAmenities = map[string][]string{
+	"restaurant": {"restaurant"},
+	"cafe":       {"cafe"},
+	"bar":        {"bar"},
+	"pub":        {"bar"},
+	"fast_food":  {"meal_takeaway", "restaurant"},
+}
+
+type overpassResponse struct {
+	Elements []overpassElement `json:"elements"`
+}
+
+type overpassElement struct {
+	Type   string            `json:"type"`
+	Id     int64             `json:"id"`
+	Lat    float64           `json:"lat"`
+	Lon    float64           `json:"lon"`
+	Center *overpassCenter   `json:"center"`
+	Tags   map[string]string `json:"tags"`
+}
+
+type overpassCenter struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("Usage: osm-import <overpass json or osm pbf file>")
+	}
+	databaseUrl := os.Getenv("DATABASE_URL")
+	if databaseUrl == "" {
+		log.Fatal("Missing $DATABASE_URL environment variable")
+	}
+
+	var elements []overpassElement
+	var err error
+	if strings.HasSuffix(os.Args[1], ".pbf") {
+		elements, err = readPbfExtract(os.Args[1])
+	} else {
+		elements, err = readOverpassExtract(os.Args[1])
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", databaseUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	placesDB := dao.PlaceDbService{DB: db}
+
+	var batch []dao.PlaceDB
+	imported := 0
+	for _, element := range elements {
+		place, ok := elementToPlace(element)
+		if !ok {
+			continue
+		}
+		batch = append(batch, place)
+		if len(batch) == batchSize {
+			err = placesDB.SaveOsmPlaces(batch)
+			if err != nil {
+				log.Fatal(err)
+			}
+			imported += len(batch)
+			batch = nil
+		}
+	}
+	err = placesDB.SaveOsmPlaces(batch)
+	if err != nil {
+		log.Fatal(err)
+	}
+	imported += len(batch)
+	log.WithFields(log.Fields{
+		"elements": len(elements),
+		"imported": imported,
+	}).Info("OSM import finished")
+}
+
+// readOverpassExtract read elements of Overpass API JSON extract
+func readOverpassExtract(path string) ([]overpassElement, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var extract overpassResponse
+	err = json.NewDecoder(file).Decode(&extract)
+	return extract.Elements, err
+}
+
+// isImported check if element with the tags is a named food amenity
+func isImported(tags map[string]string) bool {
+	_, isImportedAmenity := importedAmenities[tags["amenity"]]
+	return tags["name"] != "" && isImportedAmenity
+}
+
+// elementToPlace convert named food amenity node or way to place
+func elementToPlace(element overpassElement) (dao.PlaceDB, bool) {
+	if !isImported(element.Tags) {
+		return dao.PlaceDB{}, false
+	}
+	name := element.Tags["name"]
+	types := importedAmenities[element.Tags["amenity"]]
+	lat, lng := element.Lat, element.Lon
+	if element.Center != nil {
+		lat, lng = element.Center.Lat, element.Center.Lon
+	}
+	if lat == 0 && lng == 0 {
+		return dao.PlaceDB{}, false
+	}
+	osmId := fmt.Sprintf("%s/%d", element.Type, element.Id)
+	return dao.PlaceDB{
+		OsmId: sql.NullString{String: osmId, Valid: true},
+		Name:  name,
+		Url:   "https://www.openstreetmap.org/" + osmId,
+		Lat:   lat,
+		Lng:   lng,
+		Types: types,
+	}, true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"math"
+	"os"
+	"runtime"
+
+	"github.com/qedus/osmpbf"
+)
+
+// readPbfExtract read food amenity nodes and ways of an OSM PBF extract, ways get the center of their bounding box
+// like Overpass "out center". Relations are skipped. The file is read twice, the second time only for coordinates
+// of way nodes, so node coordinates of the whole extract are never kept in memory
+func readPbfExtract(path string) ([]overpassElement, error) {
+	var elements []overpassElement
+	var ways []*osmpbf.Way
+	wayNodes := make(map[int64]*overpassCenter)
+	err := decodePbf(path, func(entity interface{}) {
+		switch e := entity.(type) {
+		case *osmpbf.Node:
+			if isImported(e.Tags) {
+				elements = append(elements, overpassElement{Type: "node", Id: e.ID, Lat: e.Lat, Lon: e.Lon, Tags: e.Tags})
+			}
+		case *osmpbf.Way:
+			if isImported(e.Tags) {
+				ways = append(ways, e)
+				for _, nodeId := range e.NodeIDs {
+					wayNodes[nodeId] = nil
+				}
+			}
+		}
+	})
+	if err != nil || len(ways) == 0 {
+		return elements, err
+	}
+
+	err = decodePbf(path, func(entity interface{}) {
+		if node, ok := entity.(*osmpbf.Node); ok {
+			if _, isWayNode := wayNodes[node.ID]; isWayNode {
+				wayNodes[node.ID] = &overpassCenter{Lat: node.Lat, Lon: node.Lon}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, way := range ways {
+		center := boundsCenter(way.NodeIDs, wayNodes)
+		if center == nil {
+			continue
+		}
+		elements = append(elements, overpassElement{Type: "way", Id: way.ID, Center: center, Tags: way.Tags})
+	}
+	return elements, nil
+}
+
+// decodePbf call handle for every node, way and relation of the file
+func decodePbf(path string, handle func(entity interface{})) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := osmpbf.NewDecoder(file)
+	decoder.SetBufferSize(osmpbf.MaxBlobSize)
+	err = decoder.Start(runtime.GOMAXPROCS(-1))
+	if err != nil {
+		return err
+	}
+	for {
+		entity, err := decoder.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		handle(entity)
+	}
+}
+
+// boundsCenter center of bounding box of the nodes, nil if none of them is in the extract
+func boundsCenter(nodeIds []int64, nodes map[int64]*overpassCenter) *overpassCenter {
+	minLat, minLon := math.Inf(1), math.Inf(1)
+	maxLat, maxLon := math.Inf(-1), math.Inf(-1)
+	for _, nodeId := range nodeIds {
+		node := nodes[nodeId]
+		if node == nil {
+			continue
+		}
+		minLat, maxLat = math.Min(minLat, node.Lat), math.Max(maxLat, node.Lat)
+		minLon, maxLon = math.Min(minLon, node.Lon), math.Max(maxLon, node.Lon)
+	}
+	if math.IsInf(minLat, 1) {
+		return nil
+	}
+	return &overpassCenter{Lat: (minLat + maxLat) / 2, Lon: (minLon + maxLon) / 2}
+}
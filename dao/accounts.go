@@ -0,0 +1,173 @@
+package dao
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// long enough to be impossible to guess, it's the only proof of account ownership
+const accountLinkCodeLength = 16
+
+type AccountDB struct {
+	Id      uint
+	Devices []string
+}
+
+type AccountDBService struct {
+	DB *sql.DB
+}
+
+// AccountUserId user id likes of account devices are saved under
+func AccountUserId(accountId uint) string {
+	return "account:" + strconv.Itoa(int(accountId))
+}
+
+const accountFields = `a.id, array(select d.device_id from hungries.account_device d where d.account_id = a.id order by d.link_date)`
+
+// GetAccountByDevice get account the device is linked to, nil if there is no such account
+func (s *AccountDBService) GetAccountByDevice(deviceId string) (*AccountDB, error) {
+	return s.getAccount(`select `+accountFields+` from hungries.account a
+							join hungries.account_device d on d.account_id = a.id
+							where d.device_id = $1`, deviceId)
+}
+
+// GetAccountByLinkCode get account by it's link code, nil if there is no such account or the code expired
+func (s *AccountDBService) GetAccountByLinkCode(linkCode string) (*AccountDB, error) {
+	return s.getAccount(`select `+accountFields+` from hungries.account a
+							where a.link_code = $1 and a.link_code_expire_date > now()`, linkCode)
+}
+
+func (s *AccountDBService) getAccount(query string, param string) (*AccountDB, error) {
+	var account AccountDB
+	err := s.DB.QueryRow(query, param).Scan(&account.Id, pq.Array(&account.Devices))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.WithField("error", err).Error("Error getting account")
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CreateAccount create account with the device as the first one, likes of the device are moved to the account
+func (s *AccountDBService) CreateAccount(deviceId string) (*AccountDB, error) {
+	log.WithField("deviceId", deviceId).Info("Creating account")
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var accountId uint
+	err = tx.QueryRow(`insert into hungries.account default values returning id`).Scan(&accountId)
+	if err != nil {
+		log.WithField("error", err).Error("Error creating account")
+		return nil, err
+	}
+	err = linkDevice(tx, deviceId, accountId)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return s.GetAccountByDevice(deviceId)
+}
+
+// RotateLinkCode issue new link code of the account valid for lifetime, the previous one stops working
+func (s *AccountDBService) RotateLinkCode(accountId uint, lifetime time.Duration) (string, error) {
+	linkCode, err := generateCode(accountLinkCodeLength)
+	if err != nil {
+		return "", err
+	}
+	_, err = s.DB.Exec(`update hungries.account
+							set link_code = $2, link_code_expire_date = now() + $3 * interval '1 second'
+							where id = $1`,
+		accountId, linkCode, lifetime.Seconds())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"accountId": accountId,
+			"error":     err,
+		}).Error("Error rotating account link code")
+		return "", err
+	}
+	return linkCode, nil
+}
+
+// LinkDeviceByCode link device that isn't linked yet to the account with the link code and merge its likes
+// into account likes. The code is used up, so it links one device only. Returns 0 if the code is unknown or expired
+func (s *AccountDBService) LinkDeviceByCode(deviceId string, linkCode string) (uint, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	// using up the code locks account, so devices are merged one by one
+	var accountId uint
+	err = tx.QueryRow(`update hungries.account
+							set link_code = null, link_code_expire_date = null
+							where link_code = $1 and link_code_expire_date > now()
+							returning id`, linkCode).Scan(&accountId)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		log.WithField("error", err).Error("Error using account link code")
+		return 0, err
+	}
+	log.WithFields(log.Fields{
+		"deviceId":  deviceId,
+		"accountId": accountId,
+	}).Info("Linking device to account")
+	err = linkDevice(tx, deviceId, accountId)
+	if err != nil {
+		return 0, err
+	}
+	return accountId, tx.Commit()
+}
+
+// linkDevice move likes and like history of the device to the account. When both have a like of the same place
+// the one swiped later wins, likes swiped before swipe time was known are compared by update date.
+// Swipe session members and their session likes stay with the device: a session is joined by a device, its events
+// are delivered to member devices and quorum counts them, likes made in sessions are merged with the other likes
+func linkDevice(tx *sql.Tx, deviceId string, accountId uint) error {
+	userId := AccountUserId(accountId)
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`update hungries."like" a
+			set is_liked = d.is_liked, swipe_date = d.swipe_date, distance = d.distance, update_date = now()
+			from hungries."like" d
+			where a.user_id = $2 and d.user_id = $1 and d.place_id = a.place_id
+			and coalesce(d.swipe_date, d.update_date) > coalesce(a.swipe_date, a.update_date)`,
+			[]interface{}{deviceId, userId}},
+		{`insert into hungries."like" (user_id, place_id, is_liked, update_date, swipe_date, distance)
+			select $2, place_id, is_liked, update_date, swipe_date, distance from hungries."like" where user_id = $1
+			on conflict (user_id, place_id) do nothing`,
+			[]interface{}{deviceId, userId}},
+		{`delete from hungries."like" where user_id = $1`, []interface{}{deviceId}},
+		{`update hungries.like_event set user_id = $2 where user_id = $1`, []interface{}{deviceId, userId}},
+		// similarities of the account are recalculated with merged likes, the device has none anymore
+		{`insert into hungries.user_similarity_stale (user_id) values ($1), ($2) on conflict (user_id) do nothing`,
+			[]interface{}{deviceId, userId}},
+		{`insert into hungries.account_device (device_id, account_id) values ($1, $2)`, []interface{}{deviceId, accountId}},
+	}
+	for _, statement := range statements {
+		_, err := tx.Exec(statement.query, statement.args...)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"deviceId":  deviceId,
+				"accountId": accountId,
+				"error":     err,
+			}).Error("Error linking device to account")
+			return err
+		}
+	}
+	return nil
+}
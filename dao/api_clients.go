@@ -0,0 +1,127 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+type ApiClientDB struct {
+	Id         uint
+	Name       string
+	Scopes     []string
+	ExpireDate sql.NullTime
+	IsRevoked  bool
+	CreateDate time.Time
+}
+
+// IsActive check if client key is not revoked or expired
+func (c *ApiClientDB) IsActive(now time.Time) bool {
+	return !c.IsRevoked && (!c.ExpireDate.Valid || c.ExpireDate.Time.After(now))
+}
+
+var ErrApiClientExists = errors.New("api client with this name exists")
+
+type ApiClientDBService struct {
+	DB *sql.DB
+}
+
+const apiClientFields = `c.id, c.name, c.scopes, c.expire_date, c.is_revoked, c.create_date`
+
+func scanApiClient(row rowScanner) (ApiClientDB, error) {
+	var client ApiClientDB
+	err := row.Scan(&client.Id, &client.Name, pq.Array(&client.Scopes), &client.ExpireDate, &client.IsRevoked, &client.CreateDate)
+	return client, err
+}
+
+// GetClientByKeyHash get client by sha256 of its key, nil if there is no such client
+func (s *ApiClientDBService) GetClientByKeyHash(keyHash string) (*ApiClientDB, error) {
+	client, err := scanApiClient(s.DB.QueryRow(`select `+apiClientFields+` from hungries.api_client c where c.key_hash = $1`, keyHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.WithField("error", err).Error("Error getting api client")
+		return nil, err
+	}
+	return &client, nil
+}
+
+// GetClients get all clients including revoked ones
+func (s *ApiClientDBService) GetClients() ([]ApiClientDB, error) {
+	var result []ApiClientDB
+	rows, err := s.DB.Query(`select ` + apiClientFields + ` from hungries.api_client c order by c.id`)
+	if err != nil {
+		log.WithField("error", err).Error("Error getting api clients")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		client, err := scanApiClient(rows)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading api client row")
+			continue
+		}
+		result = append(result, client)
+	}
+	return result, nil
+}
+
+// CreateClient save new client with sha256 of its key
+func (s *ApiClientDBService) CreateClient(name string, keyHash string, scopes []string, expireDate sql.NullTime) (*ApiClientDB, error) {
+	log.WithFields(log.Fields{
+		"name":   name,
+		"scopes": scopes,
+	}).Info("Creating api client")
+	client, err := scanApiClient(s.DB.QueryRow(`insert into hungries.api_client as c (name, key_hash, scopes, expire_date)
+								values ($1, $2, $3, $4)
+								returning `+apiClientFields,
+		name, keyHash, pq.Array(scopes), expireDate))
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return nil, ErrApiClientExists
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"name":  name,
+			"error": err,
+		}).Error("Error creating api client")
+		return nil, err
+	}
+	return &client, nil
+}
+
+// SaveClientKey create client or replace key and scopes of existing one, it's active after that
+func (s *ApiClientDBService) SaveClientKey(name string, keyHash string, scopes []string) error {
+	_, err := s.DB.Exec(`insert into hungries.api_client (name, key_hash, scopes)
+							values ($1, $2, $3)
+							on conflict (name) do update set
+							key_hash = excluded.key_hash,
+							scopes = excluded.scopes,
+							expire_date = null,
+							is_revoked = false`,
+		name, keyHash, pq.Array(scopes))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"name":  name,
+			"error": err,
+		}).Error("Error saving api client key")
+	}
+	return err
+}
+
+// RevokeClient revoke client key, false if there is no such client
+func (s *ApiClientDBService) RevokeClient(id uint) (bool, error) {
+	result, err := s.DB.Exec(`update hungries.api_client set is_revoked = true where id = $1`, id)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"clientId": id,
+			"error":    err,
+		}).Error("Error revoking api client")
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
@@ -0,0 +1,102 @@
+package dao
+
+import (
+	"database/sql"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type DeviceTokenDBService struct {
+	DB *sql.DB
+}
+
+// RegisterDevice save the first token of the device, false if the device has tokens already
+func (s *DeviceTokenDBService) RegisterDevice(deviceId string, tokenId string, expireDate time.Time) (bool, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	// concurrent registrations of the same device wait for each other
+	_, err = tx.Exec(`select pg_advisory_xact_lock(hashtext($1))`, deviceId)
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(`insert into hungries.device_token (id, device_id, expire_date)
+							select $1, $2, $3
+							where not exists(select 1 from hungries.device_token where device_id = $2)`,
+		tokenId, deviceId, expireDate)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"deviceId": deviceId,
+			"error":    err,
+		}).Error("Error registering device")
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil || inserted == 0 {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// IsTokenActive check if token is known and not revoked, expiration is checked by token signature
+func (s *DeviceTokenDBService) IsTokenActive(tokenId string) (bool, error) {
+	var isActive bool
+	err := s.DB.QueryRow(`select exists(select 1 from hungries.device_token where id = $1 and revoke_date is null)`,
+		tokenId).Scan(&isActive)
+	if err != nil {
+		log.WithField("error", err).Error("Error checking device token")
+	}
+	return isActive, err
+}
+
+// RotateToken revoke old token and save new one, false if old token is revoked already
+func (s *DeviceTokenDBService) RotateToken(oldTokenId string, deviceId string, newTokenId string, expireDate time.Time) (bool, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`update hungries.device_token set revoke_date = now()
+							where id = $1 and device_id = $2 and revoke_date is null`, oldTokenId, deviceId)
+	if err != nil {
+		return false, err
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil || revoked == 0 {
+		return false, err
+	}
+	_, err = tx.Exec(`insert into hungries.device_token (id, device_id, expire_date) values ($1, $2, $3)`,
+		newTokenId, deviceId, expireDate)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"deviceId": deviceId,
+			"error":    err,
+		}).Error("Error rotating device token")
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// RevokeToken revoke one token of the device
+func (s *DeviceTokenDBService) RevokeToken(tokenId string) error {
+	_, err := s.DB.Exec(`update hungries.device_token set revoke_date = now() where id = $1 and revoke_date is null`, tokenId)
+	if err != nil {
+		log.WithField("error", err).Error("Error revoking device token")
+	}
+	return err
+}
+
+// RevokeDeviceTokens revoke all tokens of the device
+func (s *DeviceTokenDBService) RevokeDeviceTokens(deviceId string) error {
+	_, err := s.DB.Exec(`update hungries.device_token set revoke_date = now() where device_id = $1 and revoke_date is null`, deviceId)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"deviceId": deviceId,
+			"error":    err,
+		}).Error("Error revoking device tokens")
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package dao
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+)
+
+// page size of fixture nearby search, same as in Maps API
+const fixturePageSize = 20
+
+// FixturePlaceProvider in-memory place provider for local development and tests
+type FixturePlaceProvider struct {
+	Places []maps.PlaceDetailsResult
+	// PhotosDir directory with <photoReference>.jpg files
+	PhotosDir string
+}
+
+// NewFixturePlaceProvider load places from json file in Place Details API format,
+// photos are expected in the photos directory next to it. Places without price_level get UnknownPriceLevel
+func NewFixturePlaceProvider(path string) (*FixturePlaceProvider, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var places []maps.PlaceDetailsResult
+	err = json.Unmarshal(data, &places)
+	if err != nil {
+		return nil, err
+	}
+	var priceLevels []struct {
+		PriceLevel *int `json:"price_level"`
+	}
+	err = json.Unmarshal(data, &priceLevels)
+	if err != nil {
+		return nil, err
+	}
+	for i := range places {
+		if priceLevels[i].PriceLevel == nil {
+			places[i].PriceLevel = UnknownPriceLevel
+		}
+	}
+	log.WithFields(log.Fields{
+		"path":   path,
+		"places": len(places),
+	}).Info("Loaded fixture places")
+	return &FixturePlaceProvider{
+		Places:    places,
+		PhotosDir: filepath.Join(filepath.Dir(path), "photos"),
+	}, nil
+}
+
+// FindNearbyPlaces find fixture places within radius, closest first
+func (s *FixturePlaceProvider) FindNearbyPlaces(coordinates maps.LatLng, radius uint, pageToken string, filter SearchFilter) (maps.PlacesSearchResponse, error) {
+	offset := 0
+	if pageToken != "" {
+		var err error
+		offset, err = strconv.Atoi(pageToken)
+		if err != nil {
+			return maps.PlacesSearchResponse{}, errors.New("invalid page token " + pageToken)
+		}
+	}
+	var found []maps.PlaceDetailsResult
+	for _, p := range s.Places {
+		if GetDistance(coordinates.Lat, coordinates.Lng, p.Geometry.Location.Lat, p.Geometry.Location.Lng) > float64(radius) ||
+			!filter.Matches(p.Name, p.Types, p.PriceLevel) {
+			continue
+		}
+		if filter.OpenNow && (p.OpeningHours == nil || p.OpeningHours.OpenNow == nil || !*p.OpeningHours.OpenNow) {
+			continue
+		}
+		found = append(found, p)
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := found[i].Geometry.Location, found[j].Geometry.Location
+		return GetDistance(coordinates.Lat, coordinates.Lng, a.Lat, a.Lng) < GetDistance(coordinates.Lat, coordinates.Lng, b.Lat, b.Lng)
+	})
+
+	var response maps.PlacesSearchResponse
+	for i := offset; i < len(found) && i < offset+fixturePageSize; i++ {
+		response.Results = append(response.Results, maps.PlacesSearchResult{
+			PlaceID:    found[i].PlaceID,
+			Name:       found[i].Name,
+			Geometry:   found[i].Geometry,
+			Types:      found[i].Types,
+			PriceLevel: found[i].PriceLevel,
+			Photos:     found[i].Photos,
+		})
+	}
+	if offset+fixturePageSize < len(found) {
+		response.NextPageToken = strconv.Itoa(offset + fixturePageSize)
+	}
+	return response, nil
+}
+
+// GetPlaceInfoFromMaps get fixture place by id, fields are ignored
+func (s *FixturePlaceProvider) GetPlaceInfoFromMaps(placeId string, fields []maps.PlaceDetailsFieldMask) (maps.PlaceDetailsResult, error) {
+	for _, p := range s.Places {
+		if p.PlaceID == placeId {
+			return p, nil
+		}
+	}
+	return maps.PlaceDetailsResult{}, errors.New("NOT_FOUND: no fixture place " + placeId)
+}
+
+// GetPhoto read fixture photo from disk, size is ignored
+func (s *FixturePlaceProvider) GetPhoto(photoReference string, width uint, height uint) (maps.PlacePhotoResponse, error) {
+	file, err := os.Open(filepath.Join(s.PhotosDir, filepath.Base(photoReference)+".jpg"))
+	if err != nil {
+		return maps.PlacePhotoResponse{}, err
+	}
+	return maps.PlacePhotoResponse{
+		ContentType: "image/jpeg",
+		Data:        file,
+	}, nil
+}
@@ -6,28 +6,36 @@ import (
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"io"
+	"mime"
+	"path"
 	"time"
 )
 
 type GoogleCloudStorageService struct {
 	StorageClient *storage.Client
+	BucketName    string
 }
 
-const placePhotosBucketName = "hungries-place-photo"
-
 // UploadPhoto upload photo to bucket
 func (s *GoogleCloudStorageService) UploadPhoto(placeId string, image io.ReadCloser) (string, error) {
+	defer image.Close()
 	log.WithField("placeId", placeId).Info("Saving new photo for place")
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
-	// check if there is an object with that name
-	existingObjects := s.StorageClient.Bucket(placePhotosBucketName).Objects(ctx, &storage.Query{Prefix: placeId})
-	nextObject, _ := existingObjects.Next()
-	if nextObject != nil {
-		return getPublicUrl(placeId), nil
+	object := s.StorageClient.Bucket(s.BucketName).Object(placeId)
+	// check if there is an object with exactly that name, a prefix would match other variants of the photo
+	if _, err := object.Attrs(ctx); err == nil {
+		return s.getPublicUrl(placeId), nil
+	} else if err != storage.ErrObjectNotExist {
+		return "", fmt.Errorf("Object.Attrs: %v", err)
 	}
 	// upload object
-	wc := s.StorageClient.Bucket(placePhotosBucketName).Object(placeId).NewWriter(ctx)
+	wc := object.NewWriter(ctx)
+	// content type by name extension, photos uploaded before variants have none and are jpeg
+	wc.ContentType = mime.TypeByExtension(path.Ext(placeId))
+	if wc.ContentType == "" {
+		wc.ContentType = "image/jpeg"
+	}
 	if _, err := io.Copy(wc, image); err != nil {
 		log.WithField("placeId", placeId).Info("Error uploading new photo")
 		return "", fmt.Errorf("io.Copy: %v", err)
@@ -36,10 +44,10 @@ func (s *GoogleCloudStorageService) UploadPhoto(placeId string, image io.ReadClo
 		log.WithField("placeId", placeId).Info("Error uploading new photo")
 		return "", fmt.Errorf("Writer.Close: %v", err)
 	}
-	photoUrl := getPublicUrl(placeId)
+	photoUrl := s.getPublicUrl(placeId)
 	return photoUrl, nil
 }
 
-func getPublicUrl(placeId string) string {
-	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", placePhotosBucketName, placeId)
+func (s *GoogleCloudStorageService) getPublicUrl(placeId string) string {
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", s.BucketName, placeId)
 }
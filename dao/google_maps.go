@@ -5,12 +5,28 @@ import (
 	"errors"
 	log "github.com/sirupsen/logrus"
 	"googlemaps.github.io/maps"
+	"net/http"
+	"strings"
+	"time"
 )
 
+const pageTokenRetries = 3
+const pageTokenRetryDelay = time.Second
+
 type GoogleMapsAPIService struct {
 	MapsClient *maps.Client
 }
 
+// NewGoogleMapsAPIService create Maps API client, places without price level get UnknownPriceLevel
+func NewGoogleMapsAPIService(apiKey string) (*GoogleMapsAPIService, error) {
+	httpClient := &http.Client{Transport: &priceLevelTransport{Base: http.DefaultTransport}}
+	mapsClient, err := maps.NewClient(maps.WithAPIKey(apiKey), maps.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	return &GoogleMapsAPIService{MapsClient: mapsClient}, nil
+}
+
 // GetPlaceInfoFromMaps get place info by google id
 func (s *GoogleMapsAPIService) GetPlaceInfoFromMaps(placeId string, fields []maps.PlaceDetailsFieldMask) (maps.PlaceDetailsResult, error) {
 	log.WithField("placeId", placeId).Info("Getting info for new place from Google Maps API")
@@ -27,18 +43,31 @@ func (s *GoogleMapsAPIService) GetPlaceInfoFromMaps(placeId string, fields []map
 }
 
 // FindNearbyPlaces find nearby places
-func (s *GoogleMapsAPIService) FindNearbyPlaces(coordinates maps.LatLng, radius uint, pageToken string) (maps.PlacesSearchResponse, error) {
+func (s *GoogleMapsAPIService) FindNearbyPlaces(coordinates maps.LatLng, radius uint, pageToken string, filter SearchFilter) (maps.PlacesSearchResponse, error) {
 	log.WithFields(log.Fields{
 		"coordinates": coordinates,
 		"radius":      radius,
+		"filter":      filter,
 	}).Info("Searching for nearby places via Google Maps API")
 	searchRequest := &maps.NearbySearchRequest{
 		Radius:    radius,
 		PageToken: pageToken,
 		Location:  &coordinates,
-		Type:      maps.PlaceTypeRestaurant,
+		Type:      filter.Type,
+		Keyword:   filter.Keyword,
+		OpenNow:   filter.OpenNow,
+	}
+	if filter.IsPriceRestricted() {
+		searchRequest.MinPrice = priceLevelParam(filter.MinPrice)
+		searchRequest.MaxPrice = priceLevelParam(filter.MaxPrice)
 	}
 	nearbySearchResp, err := s.MapsClient.NearbySearch(context.Background(), searchRequest)
+	// next page token becomes valid a couple of seconds after it was issued
+	for attempt := 0; err != nil && pageToken != "" && attempt < pageTokenRetries &&
+		strings.Contains(err.Error(), "INVALID_REQUEST"); attempt++ {
+		time.Sleep(pageTokenRetryDelay)
+		nearbySearchResp, err = s.MapsClient.NearbySearch(context.Background(), searchRequest)
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"coordinates": coordinates,
@@ -0,0 +1,79 @@
+package dao
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// priceLevelTransport sets price_level of Maps API places without it to UnknownPriceLevel. Maps client decodes
+// price level as int, so places without price level could not be told from free places otherwise
+type priceLevelTransport struct {
+	Base http.RoundTripper
+}
+
+func (t *priceLevelTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.Base.RoundTrip(request)
+	if err != nil || response.StatusCode != http.StatusOK {
+		return response, err
+	}
+	var resultsField string
+	switch {
+	case strings.HasSuffix(request.URL.Path, "/place/details/json"):
+		resultsField = "result"
+	case strings.HasSuffix(request.URL.Path, "/place/nearbysearch/json"):
+		resultsField = "results"
+	default:
+		return response, nil
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(markUnknownPriceLevels(body, resultsField)))
+	response.ContentLength = -1
+	response.Header.Del("Content-Length")
+	return response, nil
+}
+
+// markUnknownPriceLevels add price_level to places of the results field which don't have it,
+// body is returned as is when it can't be parsed
+func markUnknownPriceLevels(body []byte, resultsField string) []byte {
+	var data map[string]json.RawMessage
+	if json.Unmarshal(body, &data) != nil || data[resultsField] == nil {
+		return body
+	}
+	// place details have a single place
+	isSingle := resultsField == "result"
+	results := data[resultsField]
+	if isSingle {
+		results = append(append([]byte("["), results...), ']')
+	}
+	var places []map[string]json.RawMessage
+	if json.Unmarshal(results, &places) != nil {
+		return body
+	}
+	unknownPriceLevel, _ := json.Marshal(UnknownPriceLevel)
+	for _, place := range places {
+		if _, ok := place["price_level"]; !ok {
+			place["price_level"] = unknownPriceLevel
+		}
+	}
+	var err error
+	if isSingle && len(places) == 1 {
+		data[resultsField], err = json.Marshal(places[0])
+	} else {
+		data[resultsField], err = json.Marshal(places)
+	}
+	if err != nil {
+		return body
+	}
+	marked, err := json.Marshal(data)
+	if err != nil {
+		return body
+	}
+	return marked
+}
@@ -3,10 +3,13 @@ package dao
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
 )
 
 type LikeDB struct {
@@ -15,27 +18,65 @@ type LikeDB struct {
 	IsLiked  bool
 }
 
+type LikeCount struct {
+	Likes    uint
+	Dislikes uint
+}
+
 type LikeDBService struct {
 	DB *sql.DB
 }
 
-// SaveLike save new like or dislike for userId
-func (s *LikeDBService) SaveLike(userId string, placeID uint, isLiked bool) error {
+const LikeActionLike = "like"
+const LikeActionDislike = "dislike"
+const LikeActionDelete = "delete"
+const LikeActionUndo = "undo"
+
+// LikeSwipe like or dislike made at SwipeDate on the client
+type LikeSwipe struct {
+	PlaceId   uint
+	IsLiked   bool
+	SwipeDate time.Time
+	// Location of the device when it swiped, nil if unknown
+	Location *maps.LatLng
+}
+
+const LikeSwipeApplied = "applied"
+const LikeSwipeStale = "stale"
+const LikeSwipeUnknownPlace = "unknown_place"
+
+// LikeSwipeResult status of a swipe saved in batch
+type LikeSwipeResult struct {
+	PlaceId uint
+	Status  string
+}
+
+// LikeEventDB change of like, IsLiked and PreviousIsLiked are null when there was no like
+type LikeEventDB struct {
+	Id              uint
+	UserId          string
+	PlaceId         uint
+	Action          string
+	IsLiked         sql.NullBool
+	PreviousIsLiked sql.NullBool
+	IsUndone        bool
+	EventDate       time.Time
+	// SwipeDate time of the swipe on the client, null for events saved before it was known
+	SwipeDate sql.NullTime
+}
+
+// SaveLike save new like or dislike for userId, distance to the place is saved when device location is known
+func (s *LikeDBService) SaveLike(userId string, placeID uint, isLiked bool, location *maps.LatLng) error {
 	log.WithFields(log.Fields{
 		"userId":  userId,
 		"place":   strconv.Itoa(int(placeID)),
 		"isLiked": isLiked,
 	}).Info("Saving like")
-	rows, err := s.DB.Query("insert into hungries.\"like\" (user_id, place_id, is_liked) "+
-		"values ($1, $2, $3) "+
-		"on conflict (user_id, place_id) do update set "+
-		"update_date = now(), "+
-		"is_liked    = excluded.is_liked",
-		userId,
-		placeID,
-		isLiked,
-	)
-	defer rows.Close()
+	action := LikeActionDislike
+	if isLiked {
+		action = LikeActionLike
+	}
+	_, err := s.changeLike(userId, placeID, sql.NullBool{Bool: isLiked, Valid: true}, action, location)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"userId":  userId,
@@ -47,12 +88,300 @@ func (s *LikeDBService) SaveLike(userId string, placeID uint, isLiked bool) erro
 	return err
 }
 
+// DeleteLike clear like or dislike of userId, false if there was nothing to delete
+func (s *LikeDBService) DeleteLike(userId string, placeID uint) (bool, error) {
+	log.WithFields(log.Fields{
+		"userId": userId,
+		"place":  strconv.Itoa(int(placeID)),
+	}).Info("Deleting like")
+	previous, err := s.changeLike(userId, placeID, sql.NullBool{}, LikeActionDelete, nil)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"userId": userId,
+			"place":  strconv.Itoa(int(placeID)),
+			"error":  err,
+		}).Error("Error deleting like")
+		return false, err
+	}
+	return previous.Valid, nil
+}
+
+// changeLike set like state and record the change in like history, returns previous state
+func (s *LikeDBService) changeLike(userId string, placeID uint, isLiked sql.NullBool, action string, location *maps.LatLng) (sql.NullBool, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return sql.NullBool{}, err
+	}
+	defer tx.Rollback()
+	userId, err = resolveUser(tx, userId)
+	if err != nil {
+		return sql.NullBool{}, err
+	}
+	previous, _, err := applyLike(tx, userId, placeID, isLiked, action, time.Now(), location)
+	if err != nil {
+		return sql.NullBool{}, err
+	}
+	return previous, tx.Commit()
+}
+
+// SaveLikes save swipes made offline in one transaction, swipes older than the saved like of the place are skipped.
+// Result has status of every swipe in the same order
+func (s *LikeDBService) SaveLikes(userId string, swipes []LikeSwipe) ([]LikeSwipeResult, error) {
+	log.WithFields(log.Fields{
+		"userId": userId,
+		"count":  len(swipes),
+	}).Info("Saving likes batch")
+	var placeIds []uint
+	for _, swipe := range swipes {
+		placeIds = append(placeIds, swipe.PlaceId)
+	}
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	userId, err = resolveUser(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	existingPlaces, err := getExistingPlaceIds(tx, placeIds)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply swipes in the order they were made, so the last one wins inside the batch too
+	order := make([]int, len(swipes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return swipes[order[i]].SwipeDate.Before(swipes[order[j]].SwipeDate)
+	})
+	result := make([]LikeSwipeResult, len(swipes))
+	for _, i := range order {
+		swipe := swipes[i]
+		result[i] = LikeSwipeResult{PlaceId: swipe.PlaceId}
+		if !existingPlaces[swipe.PlaceId] {
+			result[i].Status = LikeSwipeUnknownPlace
+			continue
+		}
+		action := LikeActionDislike
+		if swipe.IsLiked {
+			action = LikeActionLike
+		}
+		_, isApplied, err := applyLike(tx, userId, swipe.PlaceId, sql.NullBool{Bool: swipe.IsLiked, Valid: true}, action, swipe.SwipeDate, swipe.Location)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"userId": userId,
+				"place":  swipe.PlaceId,
+				"error":  err,
+			}).Error("Error saving likes batch")
+			return nil, err
+		}
+		result[i].Status = LikeSwipeApplied
+		if !isApplied {
+			result[i].Status = LikeSwipeStale
+		}
+	}
+	return result, tx.Commit()
+}
+
+// applyLike set like state unless saved like was swiped later than swipeDate and record the change in like history.
+// Returns previous state and if the like was changed
+func applyLike(tx *sql.Tx, userId string, placeID uint, isLiked sql.NullBool, action string, swipeDate time.Time, location *maps.LatLng) (sql.NullBool, bool, error) {
+	previous, previousSwipeDate, err := getLikeForUpdate(tx, userId, placeID)
+	if err != nil {
+		return sql.NullBool{}, false, err
+	}
+	if previousSwipeDate.Valid && previousSwipeDate.Time.After(swipeDate) {
+		return previous, false, nil
+	}
+	if !previous.Valid && !isLiked.Valid {
+		// nothing changes, don't clutter history
+		return previous, false, nil
+	}
+	err = setLike(tx, userId, placeID, isLiked, swipeDate, location)
+	if err != nil {
+		return sql.NullBool{}, false, err
+	}
+	_, err = tx.Exec(`insert into hungries.like_event (user_id, place_id, action, is_liked, previous_is_liked, swipe_date)
+						values ($1, $2, $3, $4, $5, $6)`,
+		userId, placeID, action, isLiked, previous, swipeDate)
+	if err != nil {
+		return sql.NullBool{}, false, err
+	}
+	return previous, true, nil
+}
+
+// getExistingPlaceIds get which of internal places ids exist
+func getExistingPlaceIds(tx *sql.Tx, placeIds []uint) (map[uint]bool, error) {
+	var result = make(map[uint]bool)
+	var placesIdsString []string
+	for _, p := range placeIds {
+		placesIdsString = append(placesIdsString, fmt.Sprint(p))
+	}
+	var placeIdsParam = "{" + strings.Join(placesIdsString, ",") + "}"
+	rows, err := tx.Query(`select id from hungries.place where id = any($1::int[])`, placeIdsParam)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var placeId uint
+		if err := rows.Scan(&placeId); err != nil {
+			return nil, err
+		}
+		result[placeId] = true
+	}
+	return result, rows.Err()
+}
+
+// UndoLastLike revert the last like change of userId which wasn't undone yet, nil if there is nothing to undo.
+// Changes are ordered by swipe time, so swipes submitted later in a batch don't come before newer ones
+func (s *LikeDBService) UndoLastLike(userId string) (*LikeEventDB, error) {
+	log.WithField("userId", userId).Info("Undoing last like")
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	userId, err = resolveUser(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	var last LikeEventDB
+	err = tx.QueryRow(`select id, place_id, previous_is_liked from hungries.like_event
+						where user_id = $1 and action <> $2 and not is_undone
+						order by coalesce(swipe_date, event_date) desc, id desc
+						limit 1
+						for update`, userId, LikeActionUndo).Scan(&last.Id, &last.PlaceId, &last.PreviousIsLiked)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"userId": userId,
+			"error":  err,
+		}).Error("Error getting last like")
+		return nil, err
+	}
+	current, _, err := getLikeForUpdate(tx, userId, last.PlaceId)
+	if err != nil {
+		return nil, err
+	}
+	err = setLike(tx, userId, last.PlaceId, last.PreviousIsLiked, time.Now(), nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`update hungries.like_event set is_undone = true where id = $1`, last.Id)
+	if err != nil {
+		return nil, err
+	}
+	undo := LikeEventDB{
+		UserId:          userId,
+		PlaceId:         last.PlaceId,
+		Action:          LikeActionUndo,
+		IsLiked:         last.PreviousIsLiked,
+		PreviousIsLiked: current,
+	}
+	err = tx.QueryRow(`insert into hungries.like_event (user_id, place_id, action, is_liked, previous_is_liked, undone_event_id)
+						values ($1, $2, $3, $4, $5, $6)
+						returning id, event_date`,
+		userId, last.PlaceId, LikeActionUndo, undo.IsLiked, undo.PreviousIsLiked, last.Id,
+	).Scan(&undo.Id, &undo.EventDate)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"userId": userId,
+			"error":  err,
+		}).Error("Error saving undo event")
+		return nil, err
+	}
+	return &undo, tx.Commit()
+}
+
+// GetLikeHistory get like changes of userId, newest first
+func (s *LikeDBService) GetLikeHistory(userId string, limit uint) ([]LikeEventDB, error) {
+	var result []LikeEventDB
+	rows, err := s.DB.Query(`select id, user_id, place_id, action, is_liked, previous_is_liked, is_undone, event_date, swipe_date
+								from hungries.like_event
+								where user_id = hungries.resolve_user($1)
+								order by id desc
+								limit $2`, userId, limit)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"userId": userId,
+			"error":  err,
+		}).Error("Error getting like history")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event LikeEventDB
+		err := rows.Scan(&event.Id, &event.UserId, &event.PlaceId, &event.Action,
+			&event.IsLiked, &event.PreviousIsLiked, &event.IsUndone, &event.EventDate, &event.SwipeDate)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading like event row")
+			continue
+		}
+		result = append(result, event)
+	}
+	return result, nil
+}
+
+// resolveUser get user id likes of the device are saved under, it's the account of the device if there is one
+func resolveUser(tx *sql.Tx, deviceId string) (string, error) {
+	var userId string
+	err := tx.QueryRow(`select hungries.resolve_user($1)`, deviceId).Scan(&userId)
+	return userId, err
+}
+
+// getLikeForUpdate get current like of userId with its swipe date and lock it until the end of transaction
+func getLikeForUpdate(tx *sql.Tx, userId string, placeID uint) (sql.NullBool, sql.NullTime, error) {
+	var isLiked sql.NullBool
+	var swipeDate sql.NullTime
+	err := tx.QueryRow(`select is_liked, swipe_date from hungries."like" where user_id = $1 and place_id = $2 for update`,
+		userId, placeID).Scan(&isLiked, &swipeDate)
+	if err == sql.ErrNoRows {
+		return sql.NullBool{}, sql.NullTime{}, nil
+	}
+	return isLiked, swipeDate, err
+}
+
+// setLike save like state, null state deletes the like but keeps the row with its swipe date, so older swipes
+// are still stale. Distance from location to the place is kept from the previous swipe when location is unknown.
+// Similarities of the user are recalculated on next refresh
+func setLike(tx *sql.Tx, userId string, placeID uint, isLiked sql.NullBool, swipeDate time.Time, location *maps.LatLng) error {
+	err := markSimilarityStale(tx, userId)
+	if err != nil {
+		return err
+	}
+	var locationParam sql.NullString
+	if location != nil {
+		locationParam = sql.NullString{String: LatLngToString(location.Lat, location.Lng), Valid: true}
+	}
+	_, err = tx.Exec(`insert into hungries."like" as l (user_id, place_id, is_liked, swipe_date, distance)
+						values ($1, $2, $3, $4,
+								(select ST_Distance(p.location, ST_GeomFromText($5)::geography) from hungries.place p where p.id = $2))
+						on conflict (user_id, place_id) do update set
+						update_date = now(),
+						is_liked    = excluded.is_liked,
+						swipe_date  = excluded.swipe_date,
+						distance    = coalesce(excluded.distance, l.distance)`,
+		userId,
+		placeID,
+		isLiked,
+		swipeDate,
+		locationParam,
+	)
+	return err
+}
+
 // GetLikesForDevice get likes for device and internal places ids
 func (s *LikeDBService) GetLikesForDevice(userId string, placeIds []uint) (map[uint]bool, error) {
 	log.WithField("userId", userId).Info("Getting likes for userId")
 	var result = make(map[uint]bool)
 	var query = `select place_id, is_liked from hungries."like"
-				 where user_id = $1 and place_id = any($2::int[])`
+				 where user_id = hungries.resolve_user($1) and place_id = any($2::int[]) and is_liked is not null`
 
 	var placesIdsString []string
 	for _, p := range placeIds {
@@ -80,3 +409,67 @@ func (s *LikeDBService) GetLikesForDevice(userId string, placeIds []uint) (map[u
 	}
 	return result, nil
 }
+
+// GetLikeCounts get number of likes and dislikes of all users for internal places ids
+func (s *LikeDBService) GetLikeCounts(placeIds []uint) (map[uint]LikeCount, error) {
+	var result = make(map[uint]LikeCount)
+	var query = `select place_id,
+					count(1) filter (where is_liked),
+					count(1) filter (where not is_liked)
+				 from hungries."like"
+				 where place_id = any($1::int[])
+				 group by place_id`
+
+	var placesIdsString []string
+	for _, p := range placeIds {
+		placesIdsString = append(placesIdsString, fmt.Sprint(p))
+	}
+	var placeIdsParam = "{" + strings.Join(placesIdsString, ",") + "}"
+	rows, err := s.DB.Query(query, placeIdsParam)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"places": placeIdsParam,
+			"error":  err,
+		}).Error("Error getting like counts")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var placeID uint
+		var count LikeCount
+		err := rows.Scan(&placeID, &count.Likes, &count.Dislikes)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading like count row")
+			continue
+		}
+		result[placeID] = count
+	}
+	return result, nil
+}
+
+// GetUsersWhoLiked get device ids of users who liked the place, all devices of accounts are included
+func (s *LikeDBService) GetUsersWhoLiked(placeID uint) ([]string, error) {
+	var result []string
+	rows, err := s.DB.Query(`select coalesce(d.device_id, l.user_id)
+								from hungries."like" l
+								left join hungries.account_device d on l.user_id = 'account:' || d.account_id
+								where l.place_id = $1 and l.is_liked = true`, placeID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"place": placeID,
+			"error": err,
+		}).Error("Error getting users who liked place")
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userId string
+		err := rows.Scan(&userId)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading like row")
+			continue
+		}
+		result = append(result, userId)
+	}
+	return result, nil
+}
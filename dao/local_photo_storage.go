@@ -0,0 +1,58 @@
+package dao
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LocalPhotoStorage stores photos in a directory, they are served by the API under /photos/{id}
+type LocalPhotoStorage struct {
+	Dir string
+	// BaseUrl public url of the API, photo urls are relative when it's empty
+	BaseUrl string
+}
+
+// UploadPhoto save photo to file
+func (s *LocalPhotoStorage) UploadPhoto(name string, image io.ReadCloser) (string, error) {
+	defer image.Close()
+	name = filepath.Base(name)
+	path := s.PhotoPath(name)
+	if _, err := os.Stat(path); err == nil {
+		return s.getPublicUrl(name), nil
+	}
+	log.WithField("name", name).Info("Saving new photo to disk")
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	// write to temp file first, so partially written photos are never served
+	tmp, err := os.CreateTemp(s.Dir, name+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, image); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("io.Copy: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return s.getPublicUrl(name), nil
+}
+
+// PhotoPath path of the photo file
+func (s *LocalPhotoStorage) PhotoPath(name string) string {
+	return filepath.Join(s.Dir, filepath.Base(name))
+}
+
+func (s *LocalPhotoStorage) getPublicUrl(name string) string {
+	return s.BaseUrl + "/photos/" + name
+}
@@ -0,0 +1,104 @@
+package dao
+
+import (
+	"database/sql"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MapsUsageDB number of calls of one kind in a day
+type MapsUsageDB struct {
+	Day       time.Time
+	Sku       string
+	FieldMask string
+	Outcome   string
+	Calls     int64
+}
+
+// PlaceCacheUsageDB places of search results found in db and requested from provider in a day
+type PlaceCacheUsageDB struct {
+	Day    time.Time
+	Hits   int64
+	Misses int64
+}
+
+type MapsUsageDBService struct {
+	DB *sql.DB
+}
+
+// AddUsage add calls to daily totals
+func (s *MapsUsageDBService) AddUsage(usage []MapsUsageDB, cacheUsage []PlaceCacheUsageDB) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, u := range usage {
+		_, err = tx.Exec(`insert into hungries.maps_api_usage as u (day, sku, field_mask, outcome, calls)
+							values ($1, $2, $3, $4, $5)
+							on conflict (day, sku, field_mask, outcome) do update set calls = u.calls + excluded.calls`,
+			u.Day, u.Sku, u.FieldMask, u.Outcome, u.Calls)
+		if err != nil {
+			log.WithField("error", err).Error("Error saving maps api usage")
+			return err
+		}
+	}
+	for _, u := range cacheUsage {
+		_, err = tx.Exec(`insert into hungries.place_cache_usage as u (day, hits, misses)
+							values ($1, $2, $3)
+							on conflict (day) do update set hits = u.hits + excluded.hits, misses = u.misses + excluded.misses`,
+			u.Day, u.Hits, u.Misses)
+		if err != nil {
+			log.WithField("error", err).Error("Error saving place cache usage")
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetUsage get daily calls between from and to days inclusive
+func (s *MapsUsageDBService) GetUsage(from time.Time, to time.Time) ([]MapsUsageDB, error) {
+	var result []MapsUsageDB
+	rows, err := s.DB.Query(`select day, sku, field_mask, outcome, calls from hungries.maps_api_usage
+								where day between $1 and $2
+								order by day, sku, field_mask, outcome`, from, to)
+	if err != nil {
+		log.WithField("error", err).Error("Error getting maps api usage")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u MapsUsageDB
+		err := rows.Scan(&u.Day, &u.Sku, &u.FieldMask, &u.Outcome, &u.Calls)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading maps api usage row")
+			continue
+		}
+		result = append(result, u)
+	}
+	return result, nil
+}
+
+// GetPlaceCacheUsage get daily place cache hits between from and to days inclusive
+func (s *MapsUsageDBService) GetPlaceCacheUsage(from time.Time, to time.Time) ([]PlaceCacheUsageDB, error) {
+	var result []PlaceCacheUsageDB
+	rows, err := s.DB.Query(`select day, hits, misses from hungries.place_cache_usage
+								where day between $1 and $2
+								order by day`, from, to)
+	if err != nil {
+		log.WithField("error", err).Error("Error getting place cache usage")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u PlaceCacheUsageDB
+		err := rows.Scan(&u.Day, &u.Hits, &u.Misses)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading place cache usage row")
+			continue
+		}
+		result = append(result, u)
+	}
+	return result, nil
+}
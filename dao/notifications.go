@@ -0,0 +1,52 @@
+package dao
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// NotificationService Postgres LISTEN/NOTIFY, delivers messages to every API instance
+type NotificationService struct {
+	DB          *sql.DB
+	DatabaseUrl string
+}
+
+// Notify send payload to all listeners of the channel, payload must be shorter than 8000 bytes
+func (s *NotificationService) Notify(channel string, payload string) error {
+	_, err := s.DB.Exec(`select pg_notify($1, $2)`, channel, payload)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"channel": channel,
+			"error":   err,
+		}).Error("Error sending notification")
+	}
+	return err
+}
+
+// Listen call handler for every notification on the channel, reconnects on connection loss
+func (s *NotificationService) Listen(channel string, handler func(payload string)) error {
+	listener := pq.NewListener(s.DatabaseUrl, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.WithField("error", err).Error("Notification listener error")
+		}
+	})
+	err := listener.Listen(channel)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	log.WithField("channel", channel).Info("Listening for notifications")
+	go func() {
+		for notification := range listener.Notify {
+			// nil notification is sent after reconnect
+			if notification == nil {
+				continue
+			}
+			handler(notification.Extra)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,80 @@
+package dao
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"googlemaps.github.io/maps"
+)
+
+// page size of OSM nearby search, same as in Maps API
+const osmPageSize = 20
+
+// OsmPlaceProvider place provider backed by places imported from OpenStreetMap, doesn't make any external requests
+type OsmPlaceProvider struct {
+	PlacesDB *PlaceDbService
+}
+
+// FindNearbyPlaces find imported OSM places within radius, closest first.
+// OSM places have no price level and opening hours are not imported, so open now filter is ignored
+func (s *OsmPlaceProvider) FindNearbyPlaces(coordinates maps.LatLng, radius uint, pageToken string, filter SearchFilter) (maps.PlacesSearchResponse, error) {
+	offset := 0
+	if pageToken != "" {
+		var err error
+		offset, err = strconv.Atoi(pageToken)
+		if err != nil {
+			return maps.PlacesSearchResponse{}, errors.New("invalid page token " + pageToken)
+		}
+	}
+	places, err := s.PlacesDB.FindOsmPlacesNearby(coordinates.Lat, coordinates.Lng, radius, filter, osmPageSize+1, uint(offset))
+	if err != nil {
+		return maps.PlacesSearchResponse{}, err
+	}
+	var response maps.PlacesSearchResponse
+	if len(places) > osmPageSize {
+		places = places[:osmPageSize]
+		response.NextPageToken = strconv.Itoa(offset + osmPageSize)
+	}
+	for _, p := range places {
+		response.Results = append(response.Results, maps.PlacesSearchResult{
+			PlaceID:    p.ProviderPlaceId(),
+			Name:       p.Name,
+			Types:      p.Types,
+			PriceLevel: UnknownPriceLevel,
+			Geometry: maps.AddressGeometry{
+				Location: maps.LatLng{Lat: p.Lat, Lng: p.Lng},
+			},
+		})
+	}
+	return response, nil
+}
+
+// GetPlaceInfoFromMaps get imported OSM place by prefixed OSM id, fields are ignored
+func (s *OsmPlaceProvider) GetPlaceInfoFromMaps(placeId string, fields []maps.PlaceDetailsFieldMask) (maps.PlaceDetailsResult, error) {
+	if !strings.HasPrefix(placeId, OsmPlaceIdPrefix) {
+		return maps.PlaceDetailsResult{}, errors.New("NOT_FOUND: not an OSM place " + placeId)
+	}
+	place, err := s.PlacesDB.GetPlaceByOsmId(strings.TrimPrefix(placeId, OsmPlaceIdPrefix))
+	if err != nil {
+		return maps.PlaceDetailsResult{}, err
+	}
+	if place == nil {
+		return maps.PlaceDetailsResult{}, errors.New("NOT_FOUND: no OSM place " + placeId)
+	}
+	return maps.PlaceDetailsResult{
+		PlaceID:    placeId,
+		Name:       place.Name,
+		URL:        place.Url,
+		Types:      place.Types,
+		PriceLevel: UnknownPriceLevel,
+		Geometry: maps.AddressGeometry{
+			Location: maps.LatLng{Lat: place.Lat, Lng: place.Lng},
+		},
+	}, nil
+}
+
+// GetPhoto OSM has no photos
+func (s *OsmPlaceProvider) GetPhoto(photoReference string, width uint, height uint) (maps.PlacePhotoResponse, error) {
+	return maps.PlacePhotoResponse{}, errors.New("photos are not available for OSM places")
+}
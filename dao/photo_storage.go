@@ -0,0 +1,12 @@
+package dao
+
+import "io"
+
+// PhotoStorage storage of place photos available by public url
+type PhotoStorage interface {
+	// UploadPhoto save photo under name and return its public url, existing photo is not overwritten
+	UploadPhoto(name string, image io.ReadCloser) (string, error)
+}
+
+var _ PhotoStorage = (*GoogleCloudStorageService)(nil)
+var _ PhotoStorage = (*LocalPhotoStorage)(nil)
@@ -0,0 +1,124 @@
+package dao
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+)
+
+type PlacePhotoDB struct {
+	Id             uint
+	PlaceId        uint
+	Position       int
+	PhotoReference string
+	Width          int
+	Height         int
+	Attributions   []string
+	PhotoUrl       sql.NullString
+	PhotoThumbUrl  sql.NullString
+	// PhotoWebpUrl and PhotoThumbWebpUrl webp variants of the photo
+	PhotoWebpUrl      sql.NullString
+	PhotoThumbWebpUrl sql.NullString
+	PhotoBlurhash     sql.NullString
+	PhotoColor        sql.NullString
+}
+
+type PlacePhotoDBService struct {
+	DB *sql.DB
+}
+
+// GetPlacePhotos get photos of the place in provider order, isFetched is false if photo references were never saved
+func (s *PlacePhotoDBService) GetPlacePhotos(placeId uint) (photos []PlacePhotoDB, isFetched bool, err error) {
+	err = s.DB.QueryRow(`select photos_update_date is not null from hungries.place where id = $1`, placeId).Scan(&isFetched)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"placeId": placeId,
+			"error":   err,
+		}).Error("Error checking place photos")
+		return nil, false, err
+	}
+	rows, err := s.DB.Query(`select id, place_id, position, photo_reference, coalesce(width, 0), coalesce(height, 0), attributions,
+									photo_url, photo_thumb_url, photo_blurhash, photo_color, photo_webp_url, photo_thumb_webp_url
+								from hungries.place_photo
+								where place_id = $1
+								order by position`, placeId)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"placeId": placeId,
+			"error":   err,
+		}).Error("Error getting place photos")
+		return nil, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var photo PlacePhotoDB
+		err = rows.Scan(&photo.Id, &photo.PlaceId, &photo.Position, &photo.PhotoReference, &photo.Width, &photo.Height,
+			pq.Array(&photo.Attributions), &photo.PhotoUrl, &photo.PhotoThumbUrl, &photo.PhotoBlurhash, &photo.PhotoColor,
+			&photo.PhotoWebpUrl, &photo.PhotoThumbWebpUrl)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading place photo")
+			return nil, false, err
+		}
+		photos = append(photos, photo)
+	}
+	return photos, isFetched, rows.Err()
+}
+
+// SavePhotoReferences replace photo references of the place, uploaded images of replaced photos are forgotten
+func (s *PlacePhotoDBService) SavePhotoReferences(placeId uint, photos []maps.Photo) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// lock place, so concurrent first opens of the gallery replace photos one by one
+	_, err = tx.Exec(`select 1 from hungries.place where id = $1 for update`, placeId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`delete from hungries.place_photo where place_id = $1`, placeId)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"placeId": placeId,
+			"error":   err,
+		}).Error("Error deleting place photos")
+		return err
+	}
+	for i, photo := range photos {
+		attributions := photo.HTMLAttributions
+		if attributions == nil {
+			attributions = []string{}
+		}
+		_, err = tx.Exec(`insert into hungries.place_photo (place_id, position, photo_reference, width, height, attributions)
+							values ($1, $2, $3, $4, $5, $6)`,
+			placeId, i, photo.PhotoReference, photo.Width, photo.Height, pq.Array(attributions))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"placeId": placeId,
+				"error":   err,
+			}).Error("Error saving place photo")
+			return err
+		}
+	}
+	_, err = tx.Exec(`update hungries.place set photos_update_date = now() where id = $1`, placeId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdatePlacePhoto set uploaded image of the photo
+func (s *PlacePhotoDBService) UpdatePlacePhoto(photoId uint, photo PlacePhoto) error {
+	_, err := s.DB.Exec(`update hungries.place_photo set photo_url = $2, photo_thumb_url = $3, photo_blurhash = $4, photo_color = $5,
+								photo_webp_url = $6, photo_thumb_webp_url = $7 where id = $1`,
+		photoId, photo.Url, photo.ThumbUrl, photo.Blurhash, photo.Color, photo.WebpUrl, photo.ThumbWebpUrl)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"photoId": photoId,
+			"error":   err,
+		}).Error("Error updating place photo")
+	}
+	return err
+}
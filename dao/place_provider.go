@@ -0,0 +1,87 @@
+package dao
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"googlemaps.github.io/maps"
+)
+
+// MinPriceLevel free places
+const MinPriceLevel = 0
+const MaxPriceLevel = 4
+
+// UnknownPriceLevel price level of places returned by providers when it's not known
+const UnknownPriceLevel = -1
+
+// SearchFilter nearby search filters, zero value except price range means no filtering
+type SearchFilter struct {
+	Type     maps.PlaceType
+	Keyword  string
+	OpenNow  bool
+	MinPrice int
+	MaxPrice int
+	// OpenAt is not sent to providers, it is applied to search results by stored opening hours
+	OpenAt time.Time
+}
+
+// DefaultSearchFilter restaurants of any price
+func DefaultSearchFilter() SearchFilter {
+	return SearchFilter{
+		Type:     maps.PlaceTypeRestaurant,
+		MinPrice: MinPriceLevel,
+		MaxPrice: MaxPriceLevel,
+	}
+}
+
+// IsPriceRestricted check if filter excludes some price levels
+func (f SearchFilter) IsPriceRestricted() bool {
+	return f.MinPrice > MinPriceLevel || f.MaxPrice < MaxPriceLevel
+}
+
+// IsNarrowed check if filter returns only part of places of its type
+func (f SearchFilter) IsNarrowed() bool {
+	return f.Keyword != "" || f.OpenNow || !f.OpenAt.IsZero() || f.IsPriceRestricted()
+}
+
+// Matches check if place with given attributes passes filter, open now is not checked
+func (f SearchFilter) Matches(name string, types []string, priceLevel int) bool {
+	if f.Type != "" && !containsString(types, string(f.Type)) {
+		return false
+	}
+	if f.Keyword != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(f.Keyword)) {
+		return false
+	}
+	if f.IsPriceRestricted() && (priceLevel == UnknownPriceLevel || priceLevel < f.MinPrice || priceLevel > f.MaxPrice) {
+		return false
+	}
+	return true
+}
+
+func priceLevelParam(level int) maps.PriceLevel {
+	return maps.PriceLevel(strconv.Itoa(level))
+}
+
+func containsString(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
+
+// PlaceProvider source of places for nearby search, place details and photos
+type PlaceProvider interface {
+	// FindNearbyPlaces find nearby places
+	FindNearbyPlaces(coordinates maps.LatLng, radius uint, pageToken string, filter SearchFilter) (maps.PlacesSearchResponse, error)
+	// GetPlaceInfoFromMaps get place info by provider place id
+	GetPlaceInfoFromMaps(placeId string, fields []maps.PlaceDetailsFieldMask) (maps.PlaceDetailsResult, error)
+	// GetPhoto get photo of the place
+	GetPhoto(photoReference string, width uint, height uint) (maps.PlacePhotoResponse, error)
+}
+
+var _ PlaceProvider = (*GoogleMapsAPIService)(nil)
+var _ PlaceProvider = (*FixturePlaceProvider)(nil)
+var _ PlaceProvider = (*OsmPlaceProvider)(nil)
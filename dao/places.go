@@ -2,10 +2,15 @@ package dao
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
 )
 
 type PlaceDB struct {
@@ -16,13 +21,98 @@ type PlaceDB struct {
 	Lat           float64
 	Lng           float64
 	PhotoUrl      sql.NullString
+	// PhotoThumbUrl smaller variant of the main photo for lists
+	PhotoThumbUrl sql.NullString
+	// PhotoWebpUrl and PhotoThumbWebpUrl webp variants of the main photo
+	PhotoWebpUrl      sql.NullString
+	PhotoThumbWebpUrl sql.NullString
+	// PhotoBlurhash and PhotoColor placeholders shown while the photo loads
+	PhotoBlurhash sql.NullString
+	PhotoColor    sql.NullString
+	OsmId         sql.NullString
+	Types         []string
+	PriceLevel    sql.NullInt32
+	// BusinessStatus Google business status or NOT_FOUND if the place is not known to Google anymore
+	BusinessStatus   string
+	Rating           sql.NullFloat64
+	UserRatingsTotal sql.NullInt32
+	FormattedAddress sql.NullString
+	Phone            sql.NullString
+	Website          sql.NullString
+	OpeningHours     *maps.OpeningHours
+	// UtcOffset offset of place's time zone in minutes at the moment of the last update
+	UtcOffset sql.NullInt32
+	// TimeZone IANA time zone of the place location, e.g. Europe/Berlin
+	TimeZone sql.NullString
+}
+
+const BusinessStatusOperational = "OPERATIONAL"
+const BusinessStatusClosedPermanently = "CLOSED_PERMANENTLY"
+const BusinessStatusNotFound = "NOT_FOUND"
+
+// IsGone check if place is closed for good and shouldn't be served in searches
+func (p *PlaceDB) IsGone() bool {
+	return p.BusinessStatus == BusinessStatusClosedPermanently || p.BusinessStatus == BusinessStatusNotFound
+}
+
+// placeIsNotGoneCondition sql condition for places that are not closed for good
+const placeIsNotGoneCondition = `p.business_status not in ('` + BusinessStatusClosedPermanently + `', '` + BusinessStatusNotFound + `')`
+
+// OsmPlaceIdPrefix prefix of provider place ids for places imported from OpenStreetMap
+const OsmPlaceIdPrefix = "osm:"
+
+// ProviderPlaceId id of the place in the provider it came from, google place id or prefixed OSM id
+func (p *PlaceDB) ProviderPlaceId() string {
+	if p.GooglePlaceId == "" && p.OsmId.Valid {
+		return OsmPlaceIdPrefix + p.OsmId.String
+	}
+	return p.GooglePlaceId
 }
 
 type PlaceDbService struct {
 	DB *sql.DB
 }
 
-const PlaceFields = `p.id, p.google_place_id, p.name, p.url, ST_X(p.location::geometry), ST_Y(p.location::geometry), p.photo_url`
+const PlaceFields = `p.id, coalesce(p.google_place_id, ''), p.name, p.url, ST_Y(p.location::geometry), ST_X(p.location::geometry), p.photo_url, p.osm_id, p.types, p.price_level, p.business_status,
+							p.rating, p.user_ratings_total, p.formatted_address, p.phone, p.website, p.opening_hours, p.utc_offset,
+							p.photo_thumb_url, p.photo_blurhash, p.photo_color, p.time_zone,
+							p.photo_webp_url, p.photo_thumb_webp_url`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPlace read place selected with PlaceFields, extra columns selected after them are read into extra
+func scanPlace(row rowScanner, extra ...interface{}) (PlaceDB, error) {
+	var place PlaceDB
+	var openingHours []byte
+	dest := []interface{}{
+		&place.Id, &place.GooglePlaceId, &place.Name,
+		&place.Url, &place.Lat, &place.Lng,
+		&place.PhotoUrl, &place.OsmId,
+		pq.Array(&place.Types), &place.PriceLevel,
+		&place.BusinessStatus,
+		&place.Rating, &place.UserRatingsTotal, &place.FormattedAddress,
+		&place.Phone, &place.Website, &openingHours,
+		&place.UtcOffset,
+		&place.PhotoThumbUrl, &place.PhotoBlurhash, &place.PhotoColor, &place.TimeZone,
+		&place.PhotoWebpUrl, &place.PhotoThumbWebpUrl,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err == nil && openingHours != nil {
+		err = json.Unmarshal(openingHours, &place.OpeningHours)
+	}
+	return place, err
+}
+
+// openingHoursParam opening hours as jsonb query param
+func openingHoursParam(openingHours *maps.OpeningHours) interface{} {
+	if openingHours == nil {
+		return nil
+	}
+	data, _ := json.Marshal(openingHours)
+	return string(data)
+}
 
 // PlaceExistsByGoogleId check if place exists by google id
 func (s *PlaceDbService) PlaceExistsByGoogleId(googlePlaceId string) (bool, error) {
@@ -46,28 +136,34 @@ func (s *PlaceDbService) PlaceExistsById(placeId uint) (bool, error) {
 	return result, nil
 }
 
-// GetPlaceByPlaceId get place buy it's googlePlaceId
+// GetPlaceByPlaceId get place buy it's googlePlaceId, nil if there is no such place
 func (s *PlaceDbService) GetPlaceByPlaceId(googlePlaceId string) (*PlaceDB, error) {
-	var place PlaceDB
 	row := s.DB.QueryRow(
 		`select `+PlaceFields+` from hungries.place p where p.google_place_id = $1`,
 		googlePlaceId)
-	err := row.Scan(&place.Id, &place.GooglePlaceId, &place.Name, &place.Url, &place.Lat, &place.Lng, &place.PhotoUrl)
+	place, err := scanPlace(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		log.WithField("error", err).Error("Error reading row for place")
+		return nil, err
 	}
 	return &place, nil
 }
 
-// GetPlaceById get place buy it's id
+// GetPlaceById get place buy it's id, nil if there is no such place
 func (s *PlaceDbService) GetPlaceById(id uint) (*PlaceDB, error) {
-	var place PlaceDB
 	row := s.DB.QueryRow(
 		`select `+PlaceFields+` from hungries.place p where p.id = $1`,
 		id)
-	err := row.Scan(&place.Id, &place.GooglePlaceId, &place.Name, &place.Url, &place.Lat, &place.Lng, &place.PhotoUrl)
+	place, err := scanPlace(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		log.WithField("error", err).Error("error reading row")
+		return nil, err
 	}
 	return &place, nil
 }
@@ -86,12 +182,7 @@ func (s *PlaceDbService) GetPlacesByPlaceIds(googlePlaceIds []string) ([]PlaceDB
 	defer rows.Close()
 
 	for rows.Next() {
-		var place PlaceDB
-		err := rows.Scan(
-			&place.Id, &place.GooglePlaceId, &place.Name,
-			&place.Url, &place.Lat, &place.Lng,
-			&place.PhotoUrl,
-		)
+		place, err := scanPlace(rows)
 		if err != nil {
 			log.WithField("error", err).Error("Error reading row for place")
 		}
@@ -105,7 +196,8 @@ func (s *PlaceDbService) GetPlacesByPlaceIdsForDevice(googlePlaceIds []string) (
 	var result []PlaceDB
 	var query = `select ` + PlaceFields + `
 				from hungries.place p
-				where p.google_place_id = any($1::text[])`
+				where p.google_place_id = any($1::text[])
+				or '` + OsmPlaceIdPrefix + `' || p.osm_id = any($1::text[])`
 	var placeIdsParam = "{" + strings.Join(googlePlaceIds, ",") + "}"
 	rows, err := s.DB.Query(query, placeIdsParam)
 	defer rows.Close()
@@ -117,12 +209,7 @@ func (s *PlaceDbService) GetPlacesByPlaceIdsForDevice(googlePlaceIds []string) (
 		return result, err
 	}
 	for rows.Next() {
-		var place PlaceDB
-		err := rows.Scan(
-			&place.Id, &place.GooglePlaceId, &place.Name,
-			&place.Url, &place.Lat, &place.Lng,
-			&place.PhotoUrl,
-		)
+		place, err := scanPlace(rows)
 		if err != nil {
 			log.WithField("error", err).Error("Error reading row for place")
 			continue
@@ -139,19 +226,14 @@ func (s *PlaceDbService) GetLikedPlacesForDevice(userId string) ([]PlaceDB, erro
 				join hungries."like" l 
 				on l.place_id = p.id
 				and l.is_liked = true
-				where l.user_id = $1`
+				where l.user_id = hungries.resolve_user($1)`
 	rows, err := s.DB.Query(query, userId)
 	if err != nil {
 		log.Print("Error searching liked places in db for user " + userId + " " + err.Error())
 		return result, err
 	}
 	for rows.Next() {
-		var place PlaceDB
-		err := rows.Scan(
-			&place.Id, &place.GooglePlaceId, &place.Name,
-			&place.Url, &place.Lat, &place.Lng,
-			&place.PhotoUrl,
-		)
+		place, err := scanPlace(rows)
 		if err != nil {
 			log.WithField("error", err).Error("Error reading row for place")
 			continue
@@ -161,42 +243,83 @@ func (s *PlaceDbService) GetLikedPlacesForDevice(userId string) ([]PlaceDB, erro
 	return result, nil
 }
 
+// GetRatedPlacesForDevice get places userId liked or disliked, most recent first, like status for each of them
+// and distance to the place when it was swiped, for places swiped with known location only
+func (s *PlaceDbService) GetRatedPlacesForDevice(userId string, limit uint) ([]PlaceDB, map[uint]bool, map[uint]float64, error) {
+	var result []PlaceDB
+	var likes = make(map[uint]bool)
+	var distances = make(map[uint]float64)
+	var query = `select ` + PlaceFields + `, l.is_liked, l.distance
+				from hungries.place p
+				join hungries."like" l
+				on l.place_id = p.id
+				and l.is_liked is not null
+				where l.user_id = hungries.resolve_user($1)
+				order by l.update_date desc
+				limit $2`
+	rows, err := s.DB.Query(query, userId, limit)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"userId": userId,
+			"error":  err,
+		}).Error("Error searching rated places in db")
+		return result, likes, distances, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var isLiked bool
+		var distance sql.NullInt64
+		place, err := scanPlace(rows, &isLiked, &distance)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading row for place")
+			continue
+		}
+		result = append(result, place)
+		likes[place.Id] = isLiked
+		if distance.Valid {
+			distances[place.Id] = float64(distance.Int64)
+		}
+	}
+	return result, likes, distances, nil
+}
+
 // SavePlace save new place
 func (s *PlaceDbService) SavePlace(newPlace PlaceDB) (*PlaceDB, error) {
 	log.WithField("place", newPlace).Info("Saving new place to db")
-	lastInsertId := uint(0)
-	err := s.DB.QueryRow(`insert into
-									hungries.place (google_place_id, name, url, location, photo_url) 
-								values ($1, $2, $3, ST_GeomFromText($4), nullif($5, '')) returning id`,
-		newPlace.GooglePlaceId,
-		newPlace.Name,
-		newPlace.Url,
-		LatLngToString(newPlace.Lat, newPlace.Lng),
-		newPlace.PhotoUrl,
-	).Scan(&lastInsertId)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err,
-			"place": newPlace,
-		}).Error("Error saving new place")
+	savedPlaces := s.SavePlaces([]PlaceDB{newPlace})
+	if len(savedPlaces) == 0 {
+		return nil, errors.New("place " + newPlace.GooglePlaceId + " is not saved")
 	}
-	return s.GetPlaceById(lastInsertId)
+	return &savedPlaces[0], nil
 }
 
 // SavePlaces save new places in batch
 // todo add conflict check for same google id
 func (s *PlaceDbService) SavePlaces(newPlaces []PlaceDB) []PlaceDB {
-	const numberOfParams = 5
-	var query = "insert into hungries.place (google_place_id, name, url, location, photo_url) values"
+	const numberOfParams = 16
+	var query = `insert into hungries.place (google_place_id, name, url, location, photo_url, types, price_level, business_status,
+					rating, user_ratings_total, formatted_address, phone, website, opening_hours, utc_offset, time_zone) values`
 	var params = make([]interface{}, 0, len(newPlaces)*numberOfParams)
 	for i, place := range newPlaces {
 		query += fmt.Sprintf(
-			"($%d, $%d, $%d, ST_GeomFromText($%d), nullif($%d, ''))",
+			"($%d, $%d, $%d, ST_GeomFromText($%d), nullif($%d, ''), $%d, $%d, coalesce(nullif($%d, ''), '"+BusinessStatusOperational+"'),"+
+				" $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
 			i*numberOfParams+1,
 			i*numberOfParams+2,
 			i*numberOfParams+3,
 			i*numberOfParams+4,
 			i*numberOfParams+5,
+			i*numberOfParams+6,
+			i*numberOfParams+7,
+			i*numberOfParams+8,
+			i*numberOfParams+9,
+			i*numberOfParams+10,
+			i*numberOfParams+11,
+			i*numberOfParams+12,
+			i*numberOfParams+13,
+			i*numberOfParams+14,
+			i*numberOfParams+15,
+			i*numberOfParams+16,
 		)
 		if i != len(newPlaces)-1 {
 			query += ","
@@ -207,6 +330,17 @@ func (s *PlaceDbService) SavePlaces(newPlaces []PlaceDB) []PlaceDB {
 			place.Url,
 			LatLngToString(place.Lat, place.Lng),
 			place.PhotoUrl,
+			pq.Array(place.Types),
+			place.PriceLevel,
+			place.BusinessStatus,
+			place.Rating,
+			place.UserRatingsTotal,
+			place.FormattedAddress,
+			place.Phone,
+			place.Website,
+			openingHoursParam(place.OpeningHours),
+			place.UtcOffset,
+			place.TimeZone,
 		)
 	}
 	_, err := s.DB.Exec(query, params...)
@@ -222,6 +356,270 @@ func (s *PlaceDbService) SavePlaces(newPlaces []PlaceDB) []PlaceDB {
 	return result
 }
 
+// FindPlacesNearby get places matching filter within radius in meters around coordinates, closest first,
+// except excludeIds places. Open now filter is not applied
+func (s *PlaceDbService) FindPlacesNearby(lat float64, lng float64, radius uint, filter SearchFilter, limit uint, offset uint, excludeIds []uint) ([]PlaceDB, error) {
+	return s.findPlacesNearby(lat, lng, radius, filter, limit, offset, excludeIds, placeIsNotGoneCondition)
+}
+
+// FindOsmPlacesNearby get places imported from OpenStreetMap matching filter within radius in meters around coordinates,
+// closest first. Open now filter is not applied
+func (s *PlaceDbService) FindOsmPlacesNearby(lat float64, lng float64, radius uint, filter SearchFilter, limit uint, offset uint) ([]PlaceDB, error) {
+	return s.findPlacesNearby(lat, lng, radius, filter, limit, offset, nil, "p.osm_id is not null and "+placeIsNotGoneCondition)
+}
+
+func (s *PlaceDbService) findPlacesNearby(lat float64, lng float64, radius uint, filter SearchFilter, limit uint, offset uint, excludeIds []uint, condition string) ([]PlaceDB, error) {
+	var result []PlaceDB
+	var params = []interface{}{LatLngToString(lat, lng), radius, limit, offset}
+	if len(excludeIds) > 0 {
+		ids := make([]int64, len(excludeIds))
+		for i, id := range excludeIds {
+			ids[i] = int64(id)
+		}
+		params = append(params, pq.Array(ids))
+		condition += fmt.Sprintf(" and p.id != all($%d)", len(params))
+	}
+	if filter.Type != "" {
+		params = append(params, string(filter.Type))
+		condition += fmt.Sprintf(" and $%d = any(p.types)", len(params))
+	}
+	if filter.Keyword != "" {
+		params = append(params, filter.Keyword)
+		condition += fmt.Sprintf(" and strpos(lower(p.name), lower($%d)) > 0", len(params))
+	}
+	if filter.IsPriceRestricted() {
+		params = append(params, filter.MinPrice, filter.MaxPrice)
+		condition += fmt.Sprintf(" and p.price_level between $%d and $%d", len(params)-1, len(params))
+	}
+	var query = `select ` + PlaceFields + `
+				from hungries.place p
+				where ST_DWithin(p.location, ST_GeomFromText($1)::geography, $2)
+				and ` + condition + `
+				order by ST_Distance(p.location, ST_GeomFromText($1)::geography), p.id
+				limit $3 offset $4`
+	rows, err := s.DB.Query(query, params...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"lat":    lat,
+			"lng":    lng,
+			"radius": radius,
+			"filter": filter,
+			"error":  err,
+		}).Error("Error searching nearby places in db")
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		place, err := scanPlace(rows)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading row for place")
+			continue
+		}
+		result = append(result, place)
+	}
+	return result, nil
+}
+
+// GetPlaceByOsmId get place by it's OpenStreetMap id, nil if there is no such place
+func (s *PlaceDbService) GetPlaceByOsmId(osmId string) (*PlaceDB, error) {
+	row := s.DB.QueryRow(
+		`select `+PlaceFields+` from hungries.place p where p.osm_id = $1`,
+		osmId)
+	place, err := scanPlace(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.WithField("error", err).Error("Error reading row for place")
+		return nil, err
+	}
+	return &place, nil
+}
+
+// SaveOsmPlaces insert or update places imported from OpenStreetMap in batch,
+// the last one wins when the batch has the same OSM id twice
+func (s *PlaceDbService) SaveOsmPlaces(newPlaces []PlaceDB) error {
+	newPlaces = dedupOsmPlaces(newPlaces)
+	if len(newPlaces) == 0 {
+		return nil
+	}
+	const numberOfParams = 5
+	var query = "insert into hungries.place (osm_id, name, url, location, types) values"
+	var params = make([]interface{}, 0, len(newPlaces)*numberOfParams)
+	for i, place := range newPlaces {
+		query += fmt.Sprintf(
+			"($%d, $%d, $%d, ST_GeomFromText($%d), $%d)",
+			i*numberOfParams+1,
+			i*numberOfParams+2,
+			i*numberOfParams+3,
+			i*numberOfParams+4,
+			i*numberOfParams+5,
+		)
+		if i != len(newPlaces)-1 {
+			query += ","
+		}
+		params = append(params,
+			place.OsmId,
+			place.Name,
+			place.Url,
+			LatLngToString(place.Lat, place.Lng),
+			pq.Array(place.Types),
+		)
+	}
+	query += ` on conflict (osm_id) do update set
+				name        = excluded.name,
+				types       = excluded.types,
+				url         = excluded.url,
+				location    = excluded.location,
+				update_date = now()`
+	_, err := s.DB.Exec(query, params...)
+	if err != nil {
+		log.WithField("error", err).Error("Error saving OSM places")
+	}
+	return err
+}
+
+// dedupOsmPlaces keep the last place of every OSM id, one upsert can't update the same row twice
+func dedupOsmPlaces(places []PlaceDB) []PlaceDB {
+	positions := make(map[string]int, len(places))
+	var result []PlaceDB
+	for _, place := range places {
+		if i, isDuplicate := positions[place.OsmId.String]; isDuplicate {
+			result[i] = place
+			continue
+		}
+		positions[place.OsmId.String] = len(result)
+		result = append(result, place)
+	}
+	return result
+}
+
+// ClaimStalePlaces get up to limit Google places not updated for maxAge and bump their update date,
+// so other API instances don't refresh them at the same time
+func (s *PlaceDbService) ClaimStalePlaces(maxAge time.Duration, limit uint) ([]PlaceDB, error) {
+	var result []PlaceDB
+	var query = `update hungries.place p set update_date = now()
+				where p.id in (select s.id from hungries.place s
+							   where s.google_place_id is not null
+							   and s.business_status not in ('` + BusinessStatusClosedPermanently + `', '` + BusinessStatusNotFound + `')
+							   and s.update_date < now() - make_interval(secs => $1)
+							   order by s.update_date
+							   limit $2
+							   for update skip locked)
+				returning ` + PlaceFields
+	rows, err := s.DB.Query(query, maxAge.Seconds(), limit)
+	if err != nil {
+		log.WithField("error", err).Error("Error claiming stale places")
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		place, err := scanPlace(rows)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading row for place")
+			continue
+		}
+		result = append(result, place)
+	}
+	return result, nil
+}
+
+// UpdatePlace update place details by internal id and bump update date
+func (s *PlaceDbService) UpdatePlace(place PlaceDB) error {
+	log.WithField("place", place).Info("Updating place")
+	_, err := s.DB.Exec(`update hungries.place set
+								name               = $2,
+								url                = $3,
+								location           = ST_GeomFromText($4),
+								types              = $5,
+								price_level        = $6,
+								business_status    = $7,
+								rating             = $8,
+								user_ratings_total = $9,
+								formatted_address  = $10,
+								phone              = $11,
+								website            = $12,
+								opening_hours      = $13,
+								utc_offset         = $14,
+								time_zone          = $15,
+								update_date        = now()
+							where id = $1`,
+		place.Id,
+		place.Name,
+		place.Url,
+		LatLngToString(place.Lat, place.Lng),
+		pq.Array(place.Types),
+		place.PriceLevel,
+		place.BusinessStatus,
+		place.Rating,
+		place.UserRatingsTotal,
+		place.FormattedAddress,
+		place.Phone,
+		place.Website,
+		openingHoursParam(place.OpeningHours),
+		place.UtcOffset,
+		place.TimeZone,
+	)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"place": place,
+			"error": err,
+		}).Error("Error updating place")
+	}
+	return err
+}
+
+// PlacePhoto urls of uploaded main photo variants and its placeholders
+type PlacePhoto struct {
+	Url          string
+	ThumbUrl     string
+	WebpUrl      string
+	ThumbWebpUrl string
+	Blurhash     string
+	Color        string
+}
+
+// UpdatePhoto set main photo of the place
+func (s *PlaceDbService) UpdatePhoto(placeId uint, photo PlacePhoto) error {
+	_, err := s.DB.Exec(`update hungries.place set photo_url = $2, photo_thumb_url = $3, photo_blurhash = $4, photo_color = $5,
+								photo_webp_url = $6, photo_thumb_webp_url = $7 where id = $1`,
+		placeId, photo.Url, photo.ThumbUrl, photo.Blurhash, photo.Color, photo.WebpUrl, photo.ThumbWebpUrl)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"placeId": placeId,
+			"error":   err,
+		}).Error("Error updating place photo")
+	}
+	return err
+}
+
+// RetryPlaceRefresh set update date of the claimed place, so it's stale for maxAge again after retryAfter
+// instead of a whole maxAge
+func (s *PlaceDbService) RetryPlaceRefresh(placeId uint, maxAge time.Duration, retryAfter time.Duration) error {
+	_, err := s.DB.Exec(`update hungries.place set update_date = now() - make_interval(secs => $2) where id = $1`,
+		placeId, (maxAge - retryAfter).Seconds())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"placeId": placeId,
+			"error":   err,
+		}).Error("Error scheduling place refresh retry")
+	}
+	return err
+}
+
+// UpdateBusinessStatus set business status of the place and bump update date
+func (s *PlaceDbService) UpdateBusinessStatus(placeId uint, status string) error {
+	_, err := s.DB.Exec(`update hungries.place set business_status = $2, update_date = now() where id = $1`, placeId, status)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"placeId": placeId,
+			"error":   err,
+		}).Error("Error updating place business status")
+	}
+	return err
+}
+
+// LatLngToString WKT point, PostGIS expects longitude first
 func LatLngToString(lat float64, lng float64) string {
-	return fmt.Sprintf("Point(%f %f)", lat, lng)
+	return fmt.Sprintf("Point(%f %f)", lng, lat)
 }
@@ -0,0 +1,46 @@
+package dao
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func osmPlace(osmId string, name string) PlaceDB {
+	return PlaceDB{OsmId: sql.NullString{String: osmId, Valid: true}, Name: name}
+}
+
+func TestDedupOsmPlaces(t *testing.T) {
+	tests := []struct {
+		name   string
+		places []PlaceDB
+		want   []PlaceDB
+	}{
+		{"empty batch", nil, nil},
+		{"no duplicates",
+			[]PlaceDB{osmPlace("node/1", "a"), osmPlace("node/2", "b")},
+			[]PlaceDB{osmPlace("node/1", "a"), osmPlace("node/2", "b")}},
+		{"same node twice keeps the last one at the first position",
+			[]PlaceDB{osmPlace("node/1", "old"), osmPlace("node/2", "b"), osmPlace("node/1", "new")},
+			[]PlaceDB{osmPlace("node/1", "new"), osmPlace("node/2", "b")}},
+		{"same node three times",
+			[]PlaceDB{osmPlace("node/1", "a"), osmPlace("node/1", "b"), osmPlace("node/1", "c")},
+			[]PlaceDB{osmPlace("node/1", "c")}},
+		{"node and way with the same number",
+			[]PlaceDB{osmPlace("node/1", "a"), osmPlace("way/1", "b")},
+			[]PlaceDB{osmPlace("node/1", "a"), osmPlace("way/1", "b")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := dedupOsmPlaces(test.places)
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d places, want %d", len(got), len(test.want))
+			}
+			for i := range test.want {
+				if got[i].OsmId != test.want[i].OsmId || got[i].Name != test.want[i].Name {
+					t.Fatalf("got %s %s at %d, want %s %s",
+						got[i].OsmId.String, got[i].Name, i, test.want[i].OsmId.String, test.want[i].Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package dao
+
+import (
+	"database/sql"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type RateLimitDBService struct {
+	DB *sql.DB
+}
+
+// TakeToken take one token from the bucket refilled with ratePerSecond up to burst tokens,
+// false if the bucket is empty
+func (s *RateLimitDBService) TakeToken(key string, ratePerSecond float64, burst float64) (bool, error) {
+	var tokens float64
+	err := s.DB.QueryRow(`insert into hungries.rate_limit_bucket as b (key, tokens, update_date)
+							values ($1, $3::float8 - 1, now())
+							on conflict (key) do update set
+							tokens = least($3::float8, b.tokens + extract(epoch from now() - b.update_date)::float8 * $2::float8) - 1,
+							update_date = now()
+							where least($3::float8, b.tokens + extract(epoch from now() - b.update_date)::float8 * $2::float8) >= 1
+							returning tokens`,
+		key, ratePerSecond, burst).Scan(&tokens)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"key":   key,
+			"error": err,
+		}).Error("Error taking rate limit token")
+		return false, err
+	}
+	return true, nil
+}
+
+// ReturnToken put a token back to the bucket, up to burst tokens
+func (s *RateLimitDBService) ReturnToken(key string, burst float64) error {
+	_, err := s.DB.Exec(`update hungries.rate_limit_bucket set tokens = least($2::float8, tokens + 1) where key = $1`, key, burst)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"key":   key,
+			"error": err,
+		}).Error("Error returning rate limit token")
+	}
+	return err
+}
+
+// DeleteIdleBuckets delete buckets not used for maxIdleSeconds, they are full again anyway
+func (s *RateLimitDBService) DeleteIdleBuckets(maxIdleSeconds float64) error {
+	_, err := s.DB.Exec(`delete from hungries.rate_limit_bucket where update_date < now() - make_interval(secs => $1::float8)`, maxIdleSeconds)
+	if err != nil {
+		log.WithField("error", err).Error("Error deleting idle rate limit buckets")
+	}
+	return err
+}
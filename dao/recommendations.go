@@ -0,0 +1,156 @@
+package dao
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+type RecommendationDBService struct {
+	DB *sql.DB
+}
+
+// advisory lock id, so only one API instance refreshes similarities at a time
+const recommendationsLockId = 734001
+
+// markSimilarityStale queue users whose likes changed, their similarities are recalculated on next refresh
+func markSimilarityStale(tx *sql.Tx, userId string) error {
+	_, err := tx.Exec(`insert into hungries.user_similarity_stale (user_id) values ($1) on conflict (user_id) do nothing`, userId)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"userId": userId,
+			"error":  err,
+		}).Error("Error marking user similarity stale")
+	}
+	return err
+}
+
+// RefreshSimilarities recalculate similarities of users whose likes changed since the last refresh.
+// Similarity of two users is cosine similarity of their likes, so only pairs with a changed user change.
+// Returns number of refreshed users, -1 if refresh is already running on another instance
+func (s *RecommendationDBService) RefreshSimilarities() (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var isLocked bool
+	err = tx.QueryRow(`select pg_try_advisory_xact_lock($1)`, recommendationsLockId).Scan(&isLocked)
+	if err != nil {
+		return 0, err
+	}
+	if !isLocked {
+		return -1, nil
+	}
+
+	var staleUsers []string
+	rows, err := tx.Query(`delete from hungries.user_similarity_stale returning user_id`)
+	if err != nil {
+		log.WithField("error", err).Error("Error reading stale user similarities")
+		return 0, err
+	}
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		staleUsers = append(staleUsers, userId)
+	}
+	rows.Close()
+	if len(staleUsers) == 0 {
+		return 0, tx.Commit()
+	}
+
+	_, err = tx.Exec(`delete from hungries.user_similarity where user_id = any($1) or other_user_id = any($1)`, pq.Array(staleUsers))
+	if err != nil {
+		log.WithField("error", err).Error("Error deleting stale user similarities")
+		return 0, err
+	}
+	_, err = tx.Exec(`with pair as (
+							select a.user_id, b.user_id as other_user_id, count(1) as common
+							from hungries."like" a
+							join hungries."like" b
+							on b.place_id = a.place_id
+							and b.user_id <> a.user_id
+							and b.is_liked
+							where a.is_liked
+							and a.user_id = any($1)
+							group by a.user_id, b.user_id
+						),
+						liked_count as (
+							select user_id, count(1) as likes
+							from hungries."like"
+							where is_liked
+							and user_id in (select user_id from pair union select other_user_id from pair)
+							group by user_id
+						),
+						similarity as (
+							select p.user_id, p.other_user_id, p.common / sqrt(ac.likes * bc.likes) as similarity
+							from pair p
+							join liked_count ac on ac.user_id = p.user_id
+							join liked_count bc on bc.user_id = p.other_user_id
+						)
+					insert into hungries.user_similarity (user_id, other_user_id, similarity)
+					select distinct on (user_id, other_user_id) user_id, other_user_id, similarity
+					from (select user_id, other_user_id, similarity from similarity
+						  union all
+						  select other_user_id, user_id, similarity from similarity) both_directions`,
+		pq.Array(staleUsers),
+	)
+	if err != nil {
+		log.WithField("error", err).Error("Error calculating user similarities")
+		return 0, err
+	}
+	return len(staleUsers), tx.Commit()
+}
+
+// GetRecommendations get places within radius around coordinates the user hasn't rated yet, scored by sum of
+// similarities of users who liked them, best first, and score of each of them
+func (s *RecommendationDBService) GetRecommendations(userId string, lat float64, lng float64, radius uint, limit uint) ([]PlaceDB, map[uint]float64, error) {
+	var result []PlaceDB
+	var scores = make(map[uint]float64)
+	var query = `with candidate as (
+					select l.place_id, sum(us.similarity) as score
+					from hungries.user_similarity us
+					join hungries."like" l
+					on l.user_id = us.other_user_id
+					and l.is_liked
+					join hungries.place p
+					on p.id = l.place_id
+					where us.user_id = hungries.resolve_user($1)
+					and ST_DWithin(p.location, ST_GeomFromText($2)::geography, $3)
+					and not exists(select 1 from hungries."like" own
+								   where own.user_id = us.user_id and own.place_id = l.place_id and own.is_liked is not null)
+					group by l.place_id
+				)
+				select ` + PlaceFields + `, c.score
+				from candidate c
+				join hungries.place p
+				on p.id = c.place_id
+				where ` + placeIsNotGoneCondition + `
+				order by c.score desc, p.id
+				limit $4`
+	rows, err := s.DB.Query(query, userId, LatLngToString(lat, lng), radius, limit)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"userId": userId,
+			"error":  err,
+		}).Error("Error getting recommendations")
+		return result, scores, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var score float64
+		place, err := scanPlace(rows, &score)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading row for place")
+			continue
+		}
+		result = append(result, place)
+		scores[place.Id] = score
+	}
+	return result, scores, nil
+}
@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"database/sql"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+)
+
+type SearchAreaDBService struct {
+	DB *sql.DB
+}
+
+// SaveSearchArea remember that all places of placeType within radius around coordinates were fetched from provider
+func (s *SearchAreaDBService) SaveSearchArea(lat float64, lng float64, radius uint, placeType maps.PlaceType) error {
+	log.WithFields(log.Fields{
+		"lat":       lat,
+		"lng":       lng,
+		"radius":    radius,
+		"placeType": placeType,
+	}).Info("Saving search area")
+	_, err := s.DB.Exec(`insert into hungries.search_area (location, radius, place_type) values (ST_GeomFromText($1), $2, $3)`,
+		LatLngToString(lat, lng),
+		radius,
+		string(placeType),
+	)
+	if err != nil {
+		log.WithField("error", err).Error("Error saving search area")
+	}
+	return err
+}
+
+// IsAreaSearched check if circle around coordinates is covered by search area of placeType not older than maxAge
+func (s *SearchAreaDBService) IsAreaSearched(lat float64, lng float64, radius uint, placeType maps.PlaceType, maxAge time.Duration) (bool, error) {
+	var result bool
+	row := s.DB.QueryRow(`select exists(
+									select 1 from hungries.search_area a
+									where a.radius >= $2
+									and a.place_type = $4
+									and a.search_date > now() - make_interval(secs => $3)
+									and ST_DWithin(a.location, ST_GeomFromText($1)::geography, a.radius - $2)
+								)`,
+		LatLngToString(lat, lng),
+		radius,
+		maxAge.Seconds(),
+		string(placeType),
+	)
+	err := row.Scan(&result)
+	if err != nil {
+		log.WithField("error", err).Error("Error checking search area")
+		return false, err
+	}
+	return result, nil
+}
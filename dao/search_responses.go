@@ -0,0 +1,67 @@
+package dao
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+)
+
+type SearchResponseDBService struct {
+	DB *sql.DB
+}
+
+// GetSearchResponse get cached response by key, nil if it's not cached or expired
+func (s *SearchResponseDBService) GetSearchResponse(key string) (*maps.PlacesSearchResponse, error) {
+	var data []byte
+	err := s.DB.QueryRow(`select response from hungries.search_response where key = $1 and expire_date > now()`, key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"key":   key,
+			"error": err,
+		}).Error("Error getting search response")
+		return nil, err
+	}
+	var response maps.PlacesSearchResponse
+	err = json.Unmarshal(data, &response)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"key":   key,
+			"error": err,
+		}).Error("Error decoding search response")
+		return nil, err
+	}
+	return &response, nil
+}
+
+// SaveSearchResponse cache response by key for ttlSeconds
+func (s *SearchResponseDBService) SaveSearchResponse(key string, response maps.PlacesSearchResponse, ttlSeconds float64) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(`insert into hungries.search_response (key, response, expire_date)
+						values ($1, $2, now() + make_interval(secs => $3::float8))
+						on conflict (key) do update set response = excluded.response, expire_date = excluded.expire_date`,
+		key, data, ttlSeconds)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"key":   key,
+			"error": err,
+		}).Error("Error saving search response")
+	}
+	return err
+}
+
+// DeleteExpiredSearchResponses delete responses which can't be served anymore
+func (s *SearchResponseDBService) DeleteExpiredSearchResponses() error {
+	_, err := s.DB.Exec(`delete from hungries.search_response where expire_date <= now()`)
+	if err != nil {
+		log.WithField("error", err).Error("Error deleting expired search responses")
+	}
+	return err
+}
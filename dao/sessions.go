@@ -0,0 +1,236 @@
+package dao
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"math/big"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type SessionDB struct {
+	Id          uint
+	Code        string
+	Lat         float64
+	Lng         float64
+	Radius      uint
+	PlaceType   string
+	Quorum      uint
+	MemberCount uint
+}
+
+type SessionDBService struct {
+	DB *sql.DB
+}
+
+// letters and digits that are hard to confuse when code is dictated
+const sessionCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const sessionCodeLength = 6
+const sessionCodeAttempts = 5
+
+const sessionFields = `s.id, s.code, ST_Y(s.location::geometry), ST_X(s.location::geometry), s.radius, s.place_type, s.quorum,
+				(select count(1) from hungries.swipe_session_member m where m.session_id = s.id)`
+
+// CreateSession save new session with random short code and add creator as the first member
+func (s *SessionDBService) CreateSession(newSession SessionDB, creatorId string) (*SessionDB, error) {
+	log.WithFields(log.Fields{
+		"session": newSession,
+		"userId":  creatorId,
+	}).Info("Creating swipe session")
+	for attempt := 0; attempt < sessionCodeAttempts; attempt++ {
+		code, err := generateSessionCode()
+		if err != nil {
+			return nil, err
+		}
+		var sessionId uint
+		err = s.DB.QueryRow(`insert into hungries.swipe_session (code, location, radius, place_type, quorum)
+								values ($1, ST_GeomFromText($2), $3, $4, $5)
+								on conflict (code) do nothing
+								returning id`,
+			code,
+			LatLngToString(newSession.Lat, newSession.Lng),
+			newSession.Radius,
+			newSession.PlaceType,
+			newSession.Quorum,
+		).Scan(&sessionId)
+		if err == sql.ErrNoRows {
+			// code is taken, try another one
+			continue
+		}
+		if err != nil {
+			log.WithField("error", err).Error("Error creating swipe session")
+			return nil, err
+		}
+		err = s.AddMember(sessionId, creatorId)
+		if err != nil {
+			return nil, err
+		}
+		return s.GetSessionByCode(code)
+	}
+	return nil, errors.New("can't generate unique session code")
+}
+
+// GetSessionByCode get session by it's code, nil if there is no such session
+func (s *SessionDBService) GetSessionByCode(code string) (*SessionDB, error) {
+	var session SessionDB
+	err := s.DB.QueryRow(`select `+sessionFields+` from hungries.swipe_session s where s.code = $1`, code).Scan(
+		&session.Id, &session.Code, &session.Lat, &session.Lng,
+		&session.Radius, &session.PlaceType, &session.Quorum, &session.MemberCount,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"code":  code,
+			"error": err,
+		}).Error("Error reading swipe session")
+		return nil, err
+	}
+	return &session, nil
+}
+
+// AddMember add user to session, does nothing if user is already a member
+func (s *SessionDBService) AddMember(sessionId uint, userId string) error {
+	log.WithFields(log.Fields{
+		"sessionId": sessionId,
+		"userId":    userId,
+	}).Info("Adding swipe session member")
+	_, err := s.DB.Exec(`insert into hungries.swipe_session_member (session_id, user_id) values ($1, $2)
+							on conflict (session_id, user_id) do nothing`,
+		sessionId,
+		userId,
+	)
+	if err != nil {
+		log.WithField("error", err).Error("Error adding swipe session member")
+	}
+	return err
+}
+
+// IsMember check if user joined session
+func (s *SessionDBService) IsMember(sessionId uint, userId string) (bool, error) {
+	var result bool
+	err := s.DB.QueryRow(`select exists(select 1 from hungries.swipe_session_member where session_id = $1 and user_id = $2)`,
+		sessionId,
+		userId,
+	).Scan(&result)
+	if err != nil {
+		log.WithField("error", err).Error("Error checking swipe session member")
+	}
+	return result, err
+}
+
+// GetMembers get user ids of session members
+func (s *SessionDBService) GetMembers(sessionId uint) ([]string, error) {
+	var result []string
+	rows, err := s.DB.Query(`select user_id from hungries.swipe_session_member where session_id = $1 order by join_date`, sessionId)
+	if err != nil {
+		log.WithField("error", err).Error("Error reading swipe session members")
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userId string
+		err := rows.Scan(&userId)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading swipe session member row")
+			continue
+		}
+		result = append(result, userId)
+	}
+	return result, nil
+}
+
+// SaveSessionLike save like or dislike made in session, the latest one of a member counts
+func (s *SessionDBService) SaveSessionLike(sessionId uint, userId string, placeId uint, isLiked bool) error {
+	_, err := s.DB.Exec(`insert into hungries.swipe_session_like (session_id, user_id, place_id, is_liked)
+							values ($1, $2, $3, $4)
+							on conflict (session_id, place_id, user_id) do update set
+							is_liked = excluded.is_liked,
+							like_date = now()`,
+		sessionId,
+		userId,
+		placeId,
+		isLiked,
+	)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"sessionId": sessionId,
+			"userId":    userId,
+			"placeId":   placeId,
+			"error":     err,
+		}).Error("Error saving swipe session like")
+	}
+	return err
+}
+
+// SaveMatchIfReached save match if at least requiredLikes session members liked the place in the session,
+// likes made outside of it don't count. Returns true only for a new match, so it is reported once
+func (s *SessionDBService) SaveMatchIfReached(sessionId uint, placeId uint, requiredLikes uint) (bool, error) {
+	result, err := s.DB.Exec(`insert into hungries.swipe_session_match (session_id, place_id)
+								select $1, $2
+								where (select count(1)
+									   from hungries.swipe_session_like l
+									   where l.session_id = $1
+										 and l.place_id = $2
+										 and l.is_liked = true) >= $3
+								on conflict (session_id, place_id) do nothing`,
+		sessionId,
+		placeId,
+		requiredLikes,
+	)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"sessionId": sessionId,
+			"placeId":   placeId,
+			"error":     err,
+		}).Error("Error checking swipe session match")
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted > 0, err
+}
+
+// GetMatchedPlaces get places matched in session, oldest match first
+func (s *SessionDBService) GetMatchedPlaces(sessionId uint) ([]PlaceDB, error) {
+	var result []PlaceDB
+	var query = `select ` + PlaceFields + `
+				from hungries.place p
+				join hungries.swipe_session_match sm
+				on sm.place_id = p.id
+				where sm.session_id = $1
+				order by sm.match_date`
+	rows, err := s.DB.Query(query, sessionId)
+	if err != nil {
+		log.WithField("error", err).Error("Error reading swipe session matches")
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		place, err := scanPlace(rows)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading row for place")
+			continue
+		}
+		result = append(result, place)
+	}
+	return result, nil
+}
+
+func generateSessionCode() (string, error) {
+	return generateCode(sessionCodeLength)
+}
+
+// generateCode random code of letters and digits that are hard to confuse
+func generateCode(length int) (string, error) {
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(sessionCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = sessionCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
@@ -0,0 +1,14 @@
+alter table hungries.place
+    add column if not exists types text[];
+
+alter table hungries.place
+    add column if not exists price_level int;
+
+-- nearby search used to look only for restaurants
+update hungries.place
+set types = '{restaurant}'
+where types is null
+  and google_place_id is not null;
+
+alter table hungries.search_area
+    add column if not exists place_type text not null default 'restaurant';
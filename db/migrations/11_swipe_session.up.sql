@@ -0,0 +1,27 @@
+create table if not exists hungries.swipe_session
+(
+    id          serial primary key,
+    code        text unique      not null,
+    location    geography(Point) not null,
+    radius      int              not null,
+    place_type  text             not null default 'restaurant',
+    -- number of members who must like a place for a match, 0 means all members
+    quorum      int              not null default 0,
+    create_date timestamp                 default now()
+);
+
+create table if not exists hungries.swipe_session_member
+(
+    session_id int references hungries.swipe_session (id) not null,
+    user_id    text                                       not null,
+    join_date  timestamp default now(),
+    unique (session_id, user_id)
+);
+
+create table if not exists hungries.swipe_session_match
+(
+    session_id int references hungries.swipe_session (id) not null,
+    place_id   int references hungries.place (id)         not null,
+    match_date timestamp default now(),
+    unique (session_id, place_id)
+);
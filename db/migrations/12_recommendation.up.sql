@@ -0,0 +1,8 @@
+create table if not exists hungries.recommendation
+(
+    user_id     text                               not null,
+    place_id    int references hungries.place (id) not null,
+    score       double precision                   not null,
+    update_date timestamp default now(),
+    primary key (user_id, place_id)
+);
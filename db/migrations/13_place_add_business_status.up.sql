@@ -0,0 +1,7 @@
+alter table hungries.place
+    alter column update_date type timestamp;
+
+alter table hungries.place
+    add column if not exists business_status text not null default 'OPERATIONAL';
+
+create index if not exists place_update_date_idx on hungries.place (update_date);
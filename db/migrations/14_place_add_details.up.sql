@@ -0,0 +1,7 @@
+alter table hungries.place
+    add column if not exists rating             numeric(2, 1),
+    add column if not exists user_ratings_total int,
+    add column if not exists formatted_address  text,
+    add column if not exists phone              text,
+    add column if not exists website            text,
+    add column if not exists opening_hours      jsonb;
@@ -0,0 +1,3 @@
+-- offset of place's time zone from UTC in minutes, opening hours are in local time
+alter table hungries.place
+    add column if not exists utc_offset int;
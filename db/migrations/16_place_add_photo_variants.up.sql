@@ -0,0 +1,5 @@
+-- smaller photo for lists and placeholders shown while the photo loads
+alter table hungries.place
+    add column if not exists photo_thumb_url text,
+    add column if not exists photo_blurhash text,
+    add column if not exists photo_color text;
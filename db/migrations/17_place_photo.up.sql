@@ -0,0 +1,21 @@
+-- all photos of a place in provider order, images are uploaded when the gallery is opened
+create table if not exists hungries.place_photo
+(
+    id              serial primary key,
+    place_id        int references hungries.place (id) on delete cascade not null,
+    position        int                                                 not null,
+    photo_reference text                                                not null,
+    width           int,
+    height          int,
+    -- html attributions that must be shown with the photo
+    attributions    text[]                                              not null default '{}',
+    photo_url       text,
+    photo_thumb_url text,
+    photo_blurhash  text,
+    photo_color     text,
+    unique (place_id, position)
+);
+
+-- when photo references of the place were saved, null if they were never requested
+alter table hungries.place
+    add column if not exists photos_update_date timestamp;
@@ -0,0 +1,16 @@
+-- history of like changes, is_liked is null when like was deleted
+create table if not exists hungries.like_event
+(
+    id                serial primary key,
+    user_id           text                               not null,
+    place_id          int references hungries.place (id) not null,
+    action            text                               not null,
+    is_liked          boolean,
+    previous_is_liked boolean,
+    -- undo events point to the event they reverted, reverted events are never undone again
+    undone_event_id   int references hungries.like_event (id),
+    is_undone         boolean                            not null default false,
+    event_date        timestamp                                   default now()
+);
+
+create index if not exists like_event_user_idx on hungries.like_event (user_id, id);
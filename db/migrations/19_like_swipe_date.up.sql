@@ -0,0 +1,6 @@
+-- time of the swipe on the client, swipes submitted later with an older time don't overwrite newer ones
+alter table hungries.like
+    add column if not exists swipe_date timestamptz;
+
+alter table hungries.like_event
+    add column if not exists swipe_date timestamptz;
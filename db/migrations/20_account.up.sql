@@ -0,0 +1,26 @@
+-- accounts group devices of one person, their likes are saved under 'account:<id>' user id
+create table if not exists hungries.account
+(
+    id          serial primary key,
+    -- secret code that links another device to the account
+    link_code   text unique not null,
+    create_date timestamp default now()
+);
+
+create table if not exists hungries.account_device
+(
+    device_id  text primary key,
+    account_id int references hungries.account (id) not null,
+    link_date  timestamp default now()
+);
+
+create index if not exists account_device_account_idx on hungries.account_device (account_id);
+
+-- user id likes of the device are saved under
+create or replace function hungries.resolve_user(device text) returns text
+    language sql
+    stable
+as
+$$
+select coalesce((select 'account:' || d.account_id from hungries.account_device d where d.device_id = device), device)
+$$;
@@ -0,0 +1,12 @@
+-- clients of the API, only sha256 of their keys is stored
+create table if not exists hungries.api_client
+(
+    id          serial primary key,
+    name        text unique not null,
+    key_hash    text unique not null,
+    scopes      text[]      not null default '{}',
+    -- key is not valid after expire date, null means it never expires
+    expire_date timestamptz,
+    is_revoked  boolean     not null default false,
+    create_date timestamptz          default now()
+);
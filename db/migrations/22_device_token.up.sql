@@ -0,0 +1,11 @@
+-- tokens issued to devices, id is the jti claim of the signed token
+create table if not exists hungries.device_token
+(
+    id          text primary key,
+    device_id   text        not null,
+    create_date timestamptz not null default now(),
+    expire_date timestamptz not null,
+    revoke_date timestamptz
+);
+
+create index if not exists device_token_device_idx on hungries.device_token (device_id);
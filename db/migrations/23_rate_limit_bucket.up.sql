@@ -0,0 +1,7 @@
+-- token buckets shared by all API instances
+create unlogged table if not exists hungries.rate_limit_bucket
+(
+    key         text primary key,
+    tokens      double precision not null,
+    update_date timestamptz      not null default now()
+);
@@ -0,0 +1,19 @@
+-- Maps API calls aggregated by day
+create table if not exists hungries.maps_api_usage
+(
+    day        date   not null,
+    sku        text   not null,
+    -- sorted comma separated fields of place details, empty for other calls
+    field_mask text   not null default '',
+    outcome    text   not null,
+    calls      bigint not null default 0,
+    primary key (day, sku, field_mask, outcome)
+);
+
+-- places found in db and places requested from Maps API by day
+create table if not exists hungries.place_cache_usage
+(
+    day    date primary key,
+    hits   bigint not null default 0,
+    misses bigint not null default 0
+);
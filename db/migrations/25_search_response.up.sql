@@ -0,0 +1,9 @@
+-- nearby search responses of Maps API by snapped location and filters
+create unlogged table if not exists hungries.search_response
+(
+    key         text primary key,
+    response    jsonb       not null,
+    expire_date timestamptz not null
+);
+
+create index if not exists search_response_expire_date_idx on hungries.search_response (expire_date);
@@ -0,0 +1,10 @@
+-- swipes made in a session, only they count for session matches
+create table if not exists hungries.swipe_session_like
+(
+    session_id int references hungries.swipe_session (id) not null,
+    user_id    text                                       not null,
+    place_id   int references hungries.place (id)         not null,
+    is_liked   boolean                                    not null,
+    like_date  timestamp default now(),
+    primary key (session_id, place_id, user_id)
+);
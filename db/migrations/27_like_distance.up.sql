@@ -0,0 +1,3 @@
+-- meters from the device to the place when it was swiped, null when the device didn't send its location
+alter table hungries.like
+    add column if not exists distance int;
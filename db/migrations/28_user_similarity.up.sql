@@ -0,0 +1,26 @@
+-- cosine similarity of likes of two users, stored for both directions of every pair with a common like
+create table if not exists hungries.user_similarity
+(
+    user_id       text             not null,
+    other_user_id text             not null,
+    similarity    double precision not null,
+    primary key (user_id, other_user_id)
+);
+
+-- users whose likes changed since similarities were refreshed
+create table if not exists hungries.user_similarity_stale
+(
+    user_id text primary key
+);
+
+-- users who liked the same places as a refreshed user
+create index if not exists like_place_liked_idx on hungries."like" (place_id) where is_liked;
+
+-- first refresh calculates similarities of everyone
+insert into hungries.user_similarity_stale (user_id)
+select distinct user_id
+from hungries."like"
+on conflict (user_id) do nothing;
+
+-- recommendations are scored at query time within the requested area
+drop table if exists hungries.recommendation;
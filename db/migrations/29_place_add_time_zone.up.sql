@@ -0,0 +1,3 @@
+-- IANA time zone of the place, so opening hours follow daylight saving time changes
+alter table hungries.place
+    add column if not exists time_zone text;
@@ -0,0 +1,8 @@
+-- webp variants of photos, smaller than jpeg for clients that support it
+alter table hungries.place
+    add column if not exists photo_webp_url text,
+    add column if not exists photo_thumb_webp_url text;
+
+alter table hungries.place_photo
+    add column if not exists photo_webp_url text,
+    add column if not exists photo_thumb_webp_url text;
@@ -0,0 +1,3 @@
+-- deleted like is kept with null is_liked and its swipe date, so offline swipes made before the delete don't restore it
+alter table hungries.like
+    alter column is_liked drop not null;
@@ -0,0 +1,8 @@
+-- link codes are single-use and short-lived, a new one is issued by POST /account
+alter table hungries.account
+    alter column link_code drop not null,
+    add column if not exists link_code_expire_date timestamp;
+
+-- codes issued before could be read by anyone who knew a device id
+update hungries.account
+set link_code = null;
@@ -0,0 +1,16 @@
+-- locations were stored as Point(lat lng), geography expects Point(lng lat)
+update hungries.place
+set location = ST_FlipCoordinates(location::geometry)::geography
+where location is not null;
+
+create index if not exists place_location_idx on hungries.place using gist (location);
+
+create table if not exists hungries.search_area
+(
+    id          serial primary key,
+    location    geography(Point) not null,
+    radius      int              not null,
+    search_date timestamp default now()
+);
+
+create index if not exists search_area_location_idx on hungries.search_area using gist (location);
@@ -0,0 +1,5 @@
+alter table hungries.place
+    alter column google_place_id drop not null;
+
+alter table hungries.place
+    add column if not exists osm_id text unique;
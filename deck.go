@@ -0,0 +1,86 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+const DefaultDeckSize = 10
+const MaxDeckSize = 50
+
+// max number of search pages loaded for one deck request
+const maxDeckPages = 5
+
+// FindDeck get up to size nearby places device hasn't liked or disliked yet, starting from cursor position.
+// Cursor of the response is empty when there are no more places
+func FindDeck(coordinates maps.LatLng, radius uint, filter dao.SearchFilter, deviceId string, size int, cursor pageCursor) (DeckResponse, error) {
+	log.WithFields(log.Fields{
+		"coordinates": coordinates,
+		"radius":      radius,
+		"filter":      filter,
+		"deviceId":    deviceId,
+		"size":        size,
+		"cursor":      cursor,
+	}).Info("Building swipe deck")
+
+	var deck []dao.PlaceDB
+	position, shown := cursor.Position, cursor.Shown
+	for page := 0; page < maxDeckPages; page++ {
+		placesDb, next, err := searchPlacesPage(coordinates, radius, filter, position)
+		if err != nil {
+			return DeckResponse{}, err
+		}
+		placesDb = excludePlaces(placesDb, shown)
+		likes, err := getLikes(deviceId, placesDb)
+		if err != nil {
+			return DeckResponse{}, err
+		}
+		for _, p := range placesDb {
+			if _, isRated := likes[p.Id]; isRated {
+				continue
+			}
+			if len(filterByOpeningHours([]dao.PlaceDB{p}, filter)) == 0 {
+				continue
+			}
+			deck = append(deck, p)
+			shown = append(shown, p.Id)
+			if len(deck) == size {
+				// rest of this page goes to the next deck
+				nextCursor := newPageCursor(coordinates, radius, filter, position)
+				nextCursor.Shown = shown
+				return deckResponse(deck, coordinates, Cursors.Encode(nextCursor)), nil
+			}
+		}
+		if next == nil {
+			return deckResponse(deck, coordinates, ""), nil
+		}
+		position, shown = *next, nil
+	}
+	return deckResponse(deck, coordinates, Cursors.Encode(newPageCursor(coordinates, radius, filter, position))), nil
+}
+
+// excludePlaces places without the ones with excludeIds
+func excludePlaces(places []dao.PlaceDB, excludeIds []uint) []dao.PlaceDB {
+	if len(excludeIds) == 0 {
+		return places
+	}
+	excluded := make(map[uint]bool, len(excludeIds))
+	for _, id := range excludeIds {
+		excluded[id] = true
+	}
+	var result []dao.PlaceDB
+	for _, p := range places {
+		if !excluded[p.Id] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func deckResponse(deck []dao.PlaceDB, coordinates maps.LatLng, cursor string) DeckResponse {
+	return DeckResponse{
+		Places: placeDBtoResponse(deck, map[uint]bool{}, coordinates),
+		Cursor: cursor,
+	}
+}
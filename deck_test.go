@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"hungries-api/dao"
+)
+
+func TestExcludePlaces(t *testing.T) {
+	places := []dao.PlaceDB{{Id: 1}, {Id: 2}, {Id: 3}, {Id: 4}}
+	tests := []struct {
+		name       string
+		excludeIds []uint
+		want       []uint
+	}{
+		{"nothing shown", nil, []uint{1, 2, 3, 4}},
+		{"shown places in another order", []uint{3, 1}, []uint{2, 4}},
+		{"shown place not on the page anymore", []uint{5, 2}, []uint{1, 3, 4}},
+		{"all shown", []uint{4, 3, 2, 1}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := excludePlaces(places, test.excludeIds)
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d places, want %v", len(got), test.want)
+			}
+			for i, id := range test.want {
+				if got[i].Id != id {
+					t.Fatalf("got place %d at %d, want %d", got[i].Id, i, id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const DeviceTokenHeader = "X-Device-Token"
+
+const deviceTokenLifetime = 30 * 24 * time.Hour
+
+// expired tokens can still be rotated for that long, so devices that were offline for a while are not locked out
+const deviceTokenRefreshGrace = 90 * 24 * time.Hour
+
+const deviceContextKey contextKey = "device"
+
+var ErrInvalidDeviceToken = errors.New("invalid device token")
+var ErrDeviceRegistered = errors.New("device is registered already")
+var ErrLegacyDeviceId = errors.New("device ids not generated by the server can't be registered")
+
+// jwtHeader the only header accepted, tokens signed with other algorithms are rejected
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// deviceClaims JWT claims of device token
+type deviceClaims struct {
+	DeviceId  string `json:"sub"`
+	TokenId   string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// DeviceTokenStore keeps issued tokens, so they can be rotated and revoked
+type DeviceTokenStore interface {
+	// RegisterDevice save the first token of the device, false if the device has tokens already
+	RegisterDevice(deviceId string, tokenId string, expireDate time.Time) (bool, error)
+	// IsTokenActive check if token is known and not revoked
+	IsTokenActive(tokenId string) (bool, error)
+	// RotateToken revoke old token and save new one, false if old token is revoked already
+	RotateToken(oldTokenId string, deviceId string, newTokenId string, expireDate time.Time) (bool, error)
+	RevokeToken(tokenId string) error
+	RevokeDeviceTokens(deviceId string) error
+}
+
+// DeviceTokens issues and checks HS256 JWT tokens of devices
+type DeviceTokens struct {
+	Secret []byte
+	Store  DeviceTokenStore
+	// IsRequired reject requests with device param but without token, otherwise only present tokens are checked
+	IsRequired bool
+}
+
+// RegisterDevice issue the first token of the device, new device id is generated when it's empty.
+// A legacy device id, generated by the app, proves nothing about who sends it, so it's registered
+// only during the rollout while tokens aren't required. Devices that have tokens already must use their token to get a new one
+func (t *DeviceTokens) RegisterDevice(deviceId string) (DeviceTokenResponse, error) {
+	if deviceId != "" && t.IsRequired {
+		return DeviceTokenResponse{}, ErrLegacyDeviceId
+	}
+	if deviceId == "" {
+		var err error
+		deviceId, err = generateDeviceId()
+		if err != nil {
+			return DeviceTokenResponse{}, err
+		}
+	}
+	claims, err := newDeviceClaims(deviceId)
+	if err != nil {
+		return DeviceTokenResponse{}, err
+	}
+	isRegistered, err := t.Store.RegisterDevice(deviceId, claims.TokenId, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		return DeviceTokenResponse{}, err
+	}
+	if !isRegistered {
+		return DeviceTokenResponse{}, ErrDeviceRegistered
+	}
+	return t.tokenResponse(claims)
+}
+
+// RefreshToken rotate token, the old one is revoked. Expired tokens are accepted within refresh grace period
+func (t *DeviceTokens) RefreshToken(token string) (DeviceTokenResponse, error) {
+	old, err := t.parse(token, time.Now().Add(-deviceTokenRefreshGrace))
+	if err != nil {
+		return DeviceTokenResponse{}, err
+	}
+	claims, err := newDeviceClaims(old.DeviceId)
+	if err != nil {
+		return DeviceTokenResponse{}, err
+	}
+	isRotated, err := t.Store.RotateToken(old.TokenId, old.DeviceId, claims.TokenId, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		return DeviceTokenResponse{}, err
+	}
+	if !isRotated {
+		return DeviceTokenResponse{}, ErrInvalidDeviceToken
+	}
+	return t.tokenResponse(claims)
+}
+
+// RevokeToken revoke the token or all tokens of its device
+func (t *DeviceTokens) RevokeToken(token string, allDeviceTokens bool) error {
+	claims, err := t.Verify(token)
+	if err != nil {
+		return err
+	}
+	if allDeviceTokens {
+		return t.Store.RevokeDeviceTokens(claims.DeviceId)
+	}
+	return t.Store.RevokeToken(claims.TokenId)
+}
+
+// Verify check signature, expiration and revocation of the token
+func (t *DeviceTokens) Verify(token string) (deviceClaims, error) {
+	claims, err := t.parse(token, time.Now())
+	if err != nil {
+		return deviceClaims{}, err
+	}
+	isActive, err := t.Store.IsTokenActive(claims.TokenId)
+	if err != nil {
+		return deviceClaims{}, err
+	}
+	if !isActive {
+		return deviceClaims{}, ErrInvalidDeviceToken
+	}
+	return claims, nil
+}
+
+// checkRequestDevice verify device token of the request and check it's issued to the device in path or query,
+// returns device of the token, empty when there is no token
+func (t *DeviceTokens) checkRequestDevice(r *http.Request) (string, error) {
+	requestDevice := getRequestDevice(r)
+	token := r.Header.Get(DeviceTokenHeader)
+	if token == "" {
+		if t.IsRequired && requestDevice != "" {
+			return "", ErrInvalidDeviceToken
+		}
+		return "", nil
+	}
+	claims, err := t.Verify(token)
+	if err != nil {
+		return "", err
+	}
+	if requestDevice != "" && requestDevice != claims.DeviceId {
+		return "", ErrInvalidDeviceToken
+	}
+	return claims.DeviceId, nil
+}
+
+// getRequestDevice device in path or query of the request, empty if there is none
+func getRequestDevice(r *http.Request) string {
+	if device, hasDevice := mux.Vars(r)["device"]; hasDevice {
+		return device
+	}
+	return r.URL.Query().Get("device")
+}
+
+// DeviceFromContext device of the verified token, empty when the request had no token
+func DeviceFromContext(ctx context.Context) string {
+	device, _ := ctx.Value(deviceContextKey).(string)
+	return device
+}
+
+// parse check signature of the token and that it expires after notExpiredAt
+func (t *DeviceTokens) parse(token string, notExpiredAt time.Time) (deviceClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return deviceClaims{}, ErrInvalidDeviceToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, t.sign(parts[0]+"."+parts[1])) {
+		return deviceClaims{}, ErrInvalidDeviceToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return deviceClaims{}, ErrInvalidDeviceToken
+	}
+	var claims deviceClaims
+	if json.Unmarshal(payload, &claims) != nil || claims.DeviceId == "" || claims.TokenId == "" {
+		return deviceClaims{}, ErrInvalidDeviceToken
+	}
+	if time.Unix(claims.ExpiresAt, 0).Before(notExpiredAt) {
+		return deviceClaims{}, ErrInvalidDeviceToken
+	}
+	return claims, nil
+}
+
+func (t *DeviceTokens) sign(data string) []byte {
+	mac := hmac.New(sha256.New, t.Secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (t *DeviceTokens) tokenResponse(claims deviceClaims) (DeviceTokenResponse, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return DeviceTokenResponse{}, err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return DeviceTokenResponse{
+		DeviceId:  claims.DeviceId,
+		Token:     unsigned + "." + base64.RawURLEncoding.EncodeToString(t.sign(unsigned)),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+	}, nil
+}
+
+func newDeviceClaims(deviceId string) (deviceClaims, error) {
+	tokenId := make([]byte, 16)
+	if _, err := rand.Read(tokenId); err != nil {
+		return deviceClaims{}, err
+	}
+	now := time.Now()
+	return deviceClaims{
+		DeviceId:  deviceId,
+		TokenId:   hex.EncodeToString(tokenId),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(deviceTokenLifetime).Unix(),
+	}, nil
+}
+
+// generateDeviceId random UUID v4
+func generateDeviceId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]), nil
+}
+
+// registerDeviceHandler issue the first token of a device, device param is optional
+func registerDeviceHandler(tokens *DeviceTokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := tokens.RegisterDevice(r.URL.Query().Get("device"))
+		if err == ErrDeviceRegistered {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if err == ErrLegacyDeviceId {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			log.WithField("error", err).Error("Error registering device")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+// refreshDeviceTokenHandler rotate token from X-Device-Token header
+func refreshDeviceTokenHandler(tokens *DeviceTokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := tokens.RefreshToken(r.Header.Get(DeviceTokenHeader))
+		if err == ErrInvalidDeviceToken {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.WithField("error", err).Error("Error refreshing device token")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+// revokeDeviceTokenHandler revoke token from X-Device-Token header, all tokens of the device with all=true
+func revokeDeviceTokenHandler(tokens *DeviceTokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := tokens.RevokeToken(r.Header.Get(DeviceTokenHeader), r.URL.Query().Get("all") == "true")
+		if err == ErrInvalidDeviceToken {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.WithField("error", err).Error("Error revoking device token")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
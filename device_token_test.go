@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// memoryDeviceTokenStore tokens by id with their device, revoked ones are kept
+type memoryDeviceTokenStore struct {
+	devices map[string]string
+	revoked map[string]bool
+}
+
+func newMemoryDeviceTokenStore() *memoryDeviceTokenStore {
+	return &memoryDeviceTokenStore{devices: map[string]string{}, revoked: map[string]bool{}}
+}
+
+func (s *memoryDeviceTokenStore) RegisterDevice(deviceId string, tokenId string, expireDate time.Time) (bool, error) {
+	for _, device := range s.devices {
+		if device == deviceId {
+			return false, nil
+		}
+	}
+	s.devices[tokenId] = deviceId
+	return true, nil
+}
+
+func (s *memoryDeviceTokenStore) IsTokenActive(tokenId string) (bool, error) {
+	_, isKnown := s.devices[tokenId]
+	return isKnown && !s.revoked[tokenId], nil
+}
+
+func (s *memoryDeviceTokenStore) RotateToken(oldTokenId string, deviceId string, newTokenId string, expireDate time.Time) (bool, error) {
+	if isActive, _ := s.IsTokenActive(oldTokenId); !isActive || s.devices[oldTokenId] != deviceId {
+		return false, nil
+	}
+	s.revoked[oldTokenId] = true
+	s.devices[newTokenId] = deviceId
+	return true, nil
+}
+
+func (s *memoryDeviceTokenStore) RevokeToken(tokenId string) error {
+	s.revoked[tokenId] = true
+	return nil
+}
+
+func (s *memoryDeviceTokenStore) RevokeDeviceTokens(deviceId string) error {
+	for tokenId, device := range s.devices {
+		if device == deviceId {
+			s.revoked[tokenId] = true
+		}
+	}
+	return nil
+}
+
+func testDeviceTokens() *DeviceTokens {
+	return &DeviceTokens{Secret: []byte("test secret"), Store: newMemoryDeviceTokenStore()}
+}
+
+func registerTestDevice(t *testing.T, tokens *DeviceTokens) DeviceTokenResponse {
+	t.Helper()
+	token, err := tokens.RegisterDevice("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// signedDeviceToken sign claims of a saved token with given header
+func signedDeviceToken(tokens *DeviceTokens, header string, claims deviceClaims) string {
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(tokens.sign(unsigned))
+}
+
+func TestDeviceTokenVerify(t *testing.T) {
+	tokens := testDeviceTokens()
+	token := registerTestDevice(t, tokens)
+	claims, err := tokens.Verify(token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.DeviceId != token.DeviceId {
+		t.Fatalf("got device %s, want %s", claims.DeviceId, token.DeviceId)
+	}
+}
+
+func TestDeviceTokenRejected(t *testing.T) {
+	tokens := testDeviceTokens()
+	token := registerTestDevice(t, tokens)
+	claims, _ := tokens.parse(token.Token, time.Now())
+	parts := strings.Split(token.Token, ".")
+	otherSecret := &DeviceTokens{Secret: []byte("other secret"), Store: tokens.Store}
+	expired := claims
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	otherDevice := claims
+	otherDevice.DeviceId = "other-device"
+	tests := map[string]string{
+		"wrong signature":       parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString([]byte("signature")),
+		"other secret":          signedDeviceToken(otherSecret, `{"alg":"HS256","typ":"JWT"}`, claims),
+		"alg none":              signedDeviceToken(tokens, `{"alg":"none","typ":"JWT"}`, claims),
+		"alg HS512":             signedDeviceToken(tokens, `{"alg":"HS512","typ":"JWT"}`, claims),
+		"unsigned":              parts[0] + "." + parts[1] + ".",
+		"expired":               signedDeviceToken(tokens, `{"alg":"HS256","typ":"JWT"}`, expired),
+		"payload of other user": parts[0] + "." + base64.RawURLEncoding.EncodeToString(mustMarshal(otherDevice)) + "." + parts[2],
+		"not a token":           "token",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tokens.Verify(value); err != ErrInvalidDeviceToken {
+				t.Fatalf("got %v, want %v", err, ErrInvalidDeviceToken)
+			}
+		})
+	}
+}
+
+func mustMarshal(value interface{}) []byte {
+	data, _ := json.Marshal(value)
+	return data
+}
+
+func TestDeviceTokenRevoked(t *testing.T) {
+	tokens := testDeviceTokens()
+	token := registerTestDevice(t, tokens)
+	if err := tokens.RevokeToken(token.Token, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Verify(token.Token); err != ErrInvalidDeviceToken {
+		t.Fatalf("got %v, want %v", err, ErrInvalidDeviceToken)
+	}
+	if _, err := tokens.RefreshToken(token.Token); err != ErrInvalidDeviceToken {
+		t.Fatalf("revoked token refreshed, got %v", err)
+	}
+}
+
+func TestDeviceTokenRefresh(t *testing.T) {
+	tokens := testDeviceTokens()
+	token := registerTestDevice(t, tokens)
+	refreshed, err := tokens.RefreshToken(token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.DeviceId != token.DeviceId {
+		t.Fatalf("got device %s, want %s", refreshed.DeviceId, token.DeviceId)
+	}
+	if _, err := tokens.Verify(token.Token); err != ErrInvalidDeviceToken {
+		t.Fatalf("old token is still valid, got %v", err)
+	}
+	if _, err := tokens.Verify(refreshed.Token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterDevice(t *testing.T) {
+	tokens := testDeviceTokens()
+	token := registerTestDevice(t, tokens)
+	if _, err := tokens.RegisterDevice(token.DeviceId); err != ErrDeviceRegistered {
+		t.Fatalf("registered device registered again, got %v", err)
+	}
+	if _, err := tokens.RegisterDevice("legacy-device"); err != nil {
+		t.Fatalf("legacy device isn't registered during rollout, got %v", err)
+	}
+	tokens.IsRequired = true
+	if _, err := tokens.RegisterDevice("other-legacy-device"); err != ErrLegacyDeviceId {
+		t.Fatalf("got %v, want %v", err, ErrLegacyDeviceId)
+	}
+}
+
+func TestCheckRequestDevice(t *testing.T) {
+	tokens := testDeviceTokens()
+	token := registerTestDevice(t, tokens)
+	request := func(query string, pathDevice string, token string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/places"+query, nil)
+		if pathDevice != "" {
+			r = mux.SetURLVars(r, map[string]string{"device": pathDevice})
+		}
+		if token != "" {
+			r.Header.Set(DeviceTokenHeader, token)
+		}
+		return r
+	}
+	tests := []struct {
+		name       string
+		isRequired bool
+		request    *http.Request
+		device     string
+		err        error
+	}{
+		{"token of query device", false, request("?device="+token.DeviceId, "", token.Token), token.DeviceId, nil},
+		{"token of path device", false, request("", token.DeviceId, token.Token), token.DeviceId, nil},
+		{"token without device", false, request("", "", token.Token), token.DeviceId, nil},
+		{"token of other query device", false, request("?device=other-device", "", token.Token), "", ErrInvalidDeviceToken},
+		{"token of other path device", false, request("", "other-device", token.Token), "", ErrInvalidDeviceToken},
+		{"no token during rollout", false, request("?device=other-device", "", ""), "", nil},
+		{"no token when required", true, request("?device=other-device", "", ""), "", ErrInvalidDeviceToken},
+		{"no token and no device when required", true, request("", "", ""), "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens.IsRequired = test.isRequired
+			device, err := tokens.checkRequestDevice(test.request)
+			if err != test.err || device != test.device {
+				t.Fatalf("got device %q error %v, want device %q error %v", device, err, test.device, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+const EventSessionLike = "session_like"
+const EventMatch = "match"
+const EventPlaceRefreshed = "place_refreshed"
+
+// Postgres channel for events of all API instances
+const eventsChannel = "hungries_events"
+
+// events buffered per subscriber, slow subscribers miss events
+const subscriberBufferSize = 16
+
+type Event struct {
+	Type    string `json:"type"`
+	Session string `json:"session,omitempty"`
+	PlaceId uint   `json:"placeId,omitempty"`
+	// Place of match and place_refreshed events, it's loaded by the instance delivering the event,
+	// so notifications carry only the place id and stay under Postgres payload limit
+	Place *PlaceResponse `json:"place,omitempty"`
+}
+
+// eventMessage event with devices it's addressed to
+type eventMessage struct {
+	DeviceIds []string `json:"deviceIds"`
+	Event     Event    `json:"event"`
+}
+
+// EventBackend delivers published messages to hubs
+type EventBackend interface {
+	Publish(message eventMessage) error
+	Listen(deliver func(message eventMessage)) error
+}
+
+// EventHub in-process pub/sub of device events
+type EventHub struct {
+	backend     EventBackend
+	mutex       sync.Mutex
+	subscribers map[string]map[chan Event]bool
+}
+
+var Events *EventHub
+
+// NewEventHub create hub and start receiving messages from backend
+func NewEventHub(backend EventBackend) (*EventHub, error) {
+	hub := &EventHub{
+		backend:     backend,
+		subscribers: make(map[string]map[chan Event]bool),
+	}
+	err := backend.Listen(hub.deliver)
+	if err != nil {
+		return nil, err
+	}
+	return hub, nil
+}
+
+// Subscribe get channel with events for device, call Unsubscribe when done
+func (h *EventHub) Subscribe(deviceId string) chan Event {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	events := make(chan Event, subscriberBufferSize)
+	if h.subscribers[deviceId] == nil {
+		h.subscribers[deviceId] = make(map[chan Event]bool)
+	}
+	h.subscribers[deviceId][events] = true
+	return events
+}
+
+// Unsubscribe stop sending events to channel
+func (h *EventHub) Unsubscribe(deviceId string, events chan Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.subscribers[deviceId], events)
+	if len(h.subscribers[deviceId]) == 0 {
+		delete(h.subscribers, deviceId)
+	}
+}
+
+// Publish send event to devices connected to any API instance
+func (h *EventHub) Publish(event Event, deviceIds []string) {
+	if len(deviceIds) == 0 {
+		return
+	}
+	event.Place = nil
+	err := h.backend.Publish(eventMessage{DeviceIds: deviceIds, Event: event})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"event": event,
+			"error": err,
+		}).Error("Error publishing event")
+	}
+}
+
+func (h *EventHub) deliver(message eventMessage) {
+	if !h.hasSubscribers(message.DeviceIds) {
+		return
+	}
+	if message.Event.Type == EventMatch || message.Event.Type == EventPlaceRefreshed {
+		place, err := loadEventPlace(message.Event)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"event": message.Event,
+				"error": err,
+			}).Error("Error loading event place")
+			return
+		}
+		message.Event.Place = place
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, deviceId := range message.DeviceIds {
+		for events := range h.subscribers[deviceId] {
+			select {
+			case events <- message.Event:
+			default:
+				log.WithField("deviceId", deviceId).Warn("Event subscriber is too slow, dropping event")
+			}
+		}
+	}
+}
+
+// hasSubscribers check if any of devices is connected to this API instance
+func (h *EventHub) hasSubscribers(deviceIds []string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, deviceId := range deviceIds {
+		if len(h.subscribers[deviceId]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// loadEventPlace place of the event, distance of a session match is counted from the session meeting point
+func loadEventPlace(event Event) (*PlaceResponse, error) {
+	place, err := Dao.PlacesDB.GetPlaceById(event.PlaceId)
+	if err != nil {
+		return nil, err
+	}
+	if place == nil {
+		return nil, fmt.Errorf("event place %d not found", event.PlaceId)
+	}
+	coordinates := maps.LatLng{Lat: place.Lat, Lng: place.Lng}
+	if event.Session != "" {
+		session, err := getSession(event.Session)
+		if err != nil {
+			return nil, err
+		}
+		coordinates = maps.LatLng{Lat: session.Lat, Lng: session.Lng}
+	}
+	response := placeDBtoResponse([]dao.PlaceDB{*place}, map[uint]bool{}, coordinates)[0]
+	return &response, nil
+}
+
+// LocalEventBackend delivers events only to devices connected to this API instance
+type LocalEventBackend struct {
+	deliver func(message eventMessage)
+}
+
+func (b *LocalEventBackend) Publish(message eventMessage) error {
+	b.deliver(message)
+	return nil
+}
+
+func (b *LocalEventBackend) Listen(deliver func(message eventMessage)) error {
+	b.deliver = deliver
+	return nil
+}
+
+// PostgresEventBackend delivers events to all API instances with LISTEN/NOTIFY
+type PostgresEventBackend struct {
+	Notifications *dao.NotificationService
+}
+
+func (b *PostgresEventBackend) Publish(message eventMessage) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return b.Notifications.Notify(eventsChannel, string(payload))
+}
+
+func (b *PostgresEventBackend) Listen(deliver func(message eventMessage)) error {
+	return b.Notifications.Listen(eventsChannel, func(payload string) {
+		var message eventMessage
+		err := json.Unmarshal([]byte(payload), &message)
+		if err != nil {
+			log.WithField("error", err).Error("Error reading event notification")
+			return
+		}
+		deliver(message)
+	})
+}
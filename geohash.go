@@ -0,0 +1,51 @@
+package main
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+const maxGeohashPrecision = 8
+
+// approximate width in meters of geohash cells by precision, starting with precision 1
+var geohashCellWidths = []float64{5000000, 1250000, 156000, 39100, 4890, 1220, 153, 38.2}
+
+// encodeGeohash geohash of the cell containing the point
+func encodeGeohash(lat float64, lng float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	isLng := true
+	bit := 0
+	char := 0
+	for len(hash) < precision {
+		value, valueRange := lat, &latRange
+		if isLng {
+			value, valueRange = lng, &lngRange
+		}
+		mid := (valueRange[0] + valueRange[1]) / 2
+		char <<= 1
+		if value >= mid {
+			char |= 1
+			valueRange[0] = mid
+		} else {
+			valueRange[1] = mid
+		}
+		isLng = !isLng
+		bit++
+		if bit == 5 {
+			hash = append(hash, geohashAlphabet[char])
+			bit = 0
+			char = 0
+		}
+	}
+	return string(hash)
+}
+
+// geohashPrecisionForRadius the coarsest precision with cells small enough for searches within radius
+// to share results, a cell is at most a quarter of the radius wide
+func geohashPrecisionForRadius(radius uint) int {
+	for i, width := range geohashCellWidths {
+		if width <= float64(radius)/4 {
+			return i + 1
+		}
+	}
+	return maxGeohashPrecision
+}
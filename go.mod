@@ -6,10 +6,15 @@ go 1.16
 require (
 	cloud.google.com/go v0.82.0 // indirect
 	cloud.google.com/go/storage v1.15.0
+	github.com/chai2010/webp v1.1.0
 	github.com/golang-migrate/migrate/v4 v4.14.1
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/gorilla/mux v1.8.0
+	github.com/lib/pq v1.8.0
+	github.com/qedus/osmpbf v1.2.0
 	github.com/sirupsen/logrus v1.7.0
+	github.com/zsefvlol/timezonemapper v1.0.0
+	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
 	golang.org/x/net v0.0.0-20210520170846-37e1c6afe023 // indirect
 	google.golang.org/api v0.47.0
 	google.golang.org/genproto v0.0.0-20210520160233-290a1ae68a05 // indirect
@@ -1,29 +1,43 @@
 package main
 
 import (
-	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// comment sent to idle event streams, so proxies don't close them
+const eventsKeepAliveInterval = 25 * time.Second
+
+// MaxSearchRadius Maps API doesn't search farther than that, in meters
+const MaxSearchRadius = 50000
+
 func findNearbyPlacesHandler(w http.ResponseWriter, r *http.Request) {
 	deviceId := getStringParamWithDefault(r.URL.Query(), "device", "")
-	pageToken, err := getStringParamRequired(r.URL.Query(), "pagetoken")
-	radius, _ := strconv.ParseUint(r.URL.Query()["radius"][0], 10, 64)
-	coordinates, err := getCoordinatesParam(r.URL.Query(), "coordinates")
+	coordinates, radius, filter, cursor, err := getSearchParams(r.URL.Query(), "pagetoken")
 	if err != nil {
-		log.WithField("error", err).Error("Incorrect input data")
+		writeSearchParamsError(w, err)
+		return
+	}
+
+	sortBy := getStringParamWithDefault(r.URL.Query(), "sort", SortRelevance)
+	if sortBy != SortRelevance && sortBy != SortDistance && sortBy != SortPopularity {
+		log.WithField("sort", sortBy).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	places, err := FindNearbyPlaces(coordinates, uint(radius), pageToken, deviceId)
+	places, err := FindNearbyPlaces(coordinates, radius, filter, cursor.Position, deviceId, sortBy)
 	if err != nil {
 		log.WithField("error", err).Error("Error discovering places")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -33,6 +47,72 @@ func findNearbyPlacesHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(places)
 }
 
+func getDeckHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	size, err := strconv.Atoi(getStringParamWithDefault(r.URL.Query(), "size", strconv.Itoa(DefaultDeckSize)))
+	if err != nil || size < 1 || size > MaxDeckSize {
+		log.WithField("size", size).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	coordinates, radius, filter, cursor, err := getSearchParams(r.URL.Query(), "cursor")
+	if err != nil {
+		writeSearchParamsError(w, err)
+		return
+	}
+
+	deck, err := FindDeck(coordinates, radius, filter, deviceId, size, cursor)
+	if err != nil {
+		log.WithField("error", err).Error("Error building deck")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deck)
+}
+
+// getSearchParams read coordinates, radius and filter params, or take them from the page cursor
+// in cursorParam when the request continues a search
+func getSearchParams(values url.Values, cursorParam string) (maps.LatLng, uint, dao.SearchFilter, pageCursor, error) {
+	if value := getStringParamWithDefault(values, cursorParam, ""); value != "" {
+		cursor, err := Cursors.Decode(value)
+		if err != nil {
+			return maps.LatLng{}, 0, dao.SearchFilter{}, pageCursor{}, err
+		}
+		coordinates, radius, filter := cursor.searchParams()
+		return coordinates, radius, filter, cursor, nil
+	}
+	radius, err := getRadiusParam(values)
+	if err != nil {
+		return maps.LatLng{}, 0, dao.SearchFilter{}, pageCursor{}, err
+	}
+	coordinates, err := getCoordinatesParamRequired(values, "coordinates")
+	if err != nil {
+		return maps.LatLng{}, 0, dao.SearchFilter{}, pageCursor{}, err
+	}
+	filter, err := getSearchFilterParams(values)
+	if err != nil {
+		return maps.LatLng{}, 0, dao.SearchFilter{}, pageCursor{}, err
+	}
+	return coordinates, radius, filter, pageCursor{}, nil
+}
+
+func writeSearchParamsError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrPageCursorExpired:
+		log.WithField("error", err).Info("Search should be started again")
+		w.WriteHeader(http.StatusGone)
+	default:
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
 func getLikedPlacesHandler(w http.ResponseWriter, r *http.Request) {
 	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
 	coordinates, err := getCoordinatesParam(r.URL.Query(), "coordinates")
@@ -41,7 +121,13 @@ func getLikedPlacesHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	places, err := FindLikedPlaces(deviceId, coordinates)
+	openAt, err := getTimeParam(r.URL.Query(), "openAt")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	places, err := FindLikedPlaces(deviceId, coordinates, openAt)
 	if err != nil {
 		log.Print(err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
@@ -51,6 +137,42 @@ func getLikedPlacesHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(places)
 }
 
+func getRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	radius, err := strconv.ParseUint(getStringParamWithDefault(r.URL.Query(), "radius", strconv.Itoa(DefaultRecommendationsRadius)), 10, 64)
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.ParseUint(getStringParamWithDefault(r.URL.Query(), "limit", strconv.Itoa(DefaultRecommendationsLimit)), 10, 64)
+	if err != nil || limit == 0 || limit > MaxRecommendationsLimit {
+		log.WithField("limit", limit).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	coordinates, err := getCoordinatesParamRequired(r.URL.Query(), "coordinates")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	places, err := FindRecommendedPlaces(deviceId, coordinates, uint(radius), uint(limit))
+	if err != nil {
+		log.WithField("error", err).Error("Error getting recommendations")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(places)
+}
+
 func saveLikeHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	placeId, err := strconv.ParseUint(vars["place"], 10, 64)
@@ -73,7 +195,14 @@ func saveLikeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = Dao.LikesDB.SaveLike(deviceUUID, uint(placeId), isLiked)
+	// optional device location to remember how far the place was when swiped
+	var location *maps.LatLng
+	if _, hasCoordinates := r.URL.Query()["coordinates"]; hasCoordinates {
+		value, _ := getCoordinatesParam(r.URL.Query(), "coordinates")
+		location = &value
+	}
+
+	err = Dao.LikesDB.SaveLike(deviceUUID, uint(placeId), isLiked, location)
 	if err != nil {
 		log.WithField("error", err).Error("Error submitting like/dislike")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -83,6 +212,526 @@ func saveLikeHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+func saveLikeBatchHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var swipes []LikeSwipeRequest
+	err = json.NewDecoder(r.Body).Decode(&swipes)
+	if err != nil || len(swipes) > MaxLikeBatchSize {
+		log.WithField("error", err).Error("Incorrect likes batch")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, swipe := range swipes {
+		if swipe.Liked == nil || swipe.SwipedAt == nil {
+			log.WithField("placeId", swipe.PlaceId).Error("Incorrect likes batch, liked and swipedAt are required")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := SaveLikeBatch(deviceId, swipes)
+	if err != nil {
+		log.WithField("error", err).Error("Error saving likes batch")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func deleteLikeHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	placeId, err := strconv.ParseUint(vars["place"], 10, 64)
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	isDeleted, err := Dao.LikesDB.DeleteLike(vars["device"], uint(placeId))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !isDeleted {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func undoLikeHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	coordinates, _ := getCoordinatesParam(r.URL.Query(), "coordinates")
+
+	place, err := UndoLastSwipe(deviceId, coordinates)
+	if err != nil {
+		log.WithField("error", err).Error("Error undoing like")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if place == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(place)
+}
+
+func getLikeHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.ParseUint(getStringParamWithDefault(r.URL.Query(), "limit", strconv.Itoa(DefaultLikeHistoryLimit)), 10, 64)
+	if err != nil || limit == 0 || limit > MaxLikeHistoryLimit {
+		log.WithField("limit", limit).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	events, err := GetLikeHistory(deviceId, uint(limit))
+	if err != nil {
+		log.WithField("error", err).Error("Error getting like history")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+func getPlaceHandler(w http.ResponseWriter, r *http.Request) {
+	placeId, err := strconv.ParseUint(mux.Vars(r)["place"], 10, 64)
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	place, err := Dao.PlacesDB.GetPlaceById(uint(placeId))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writePlaceDetail(w, r, place)
+}
+
+func getPlaceByGoogleIdHandler(w http.ResponseWriter, r *http.Request) {
+	place, err := FindPlaceByGoogleId(mux.Vars(r)["googlePlaceId"])
+	if err != nil {
+		log.WithField("error", err).Error("Error getting place")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writePlaceDetail(w, r, place)
+}
+
+// writePlaceDetail write place detail for optional device and coordinates params, 404 if there is no place
+func writePlaceDetail(w http.ResponseWriter, r *http.Request, place *dao.PlaceDB) {
+	if place == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	deviceId := getStringParamWithDefault(r.URL.Query(), "device", "")
+	var coordinates *maps.LatLng
+	if _, hasCoordinates := r.URL.Query()["coordinates"]; hasCoordinates {
+		value, _ := getCoordinatesParam(r.URL.Query(), "coordinates")
+		coordinates = &value
+	}
+
+	detail, err := GetPlaceDetail(*place, deviceId, coordinates)
+	if err != nil {
+		log.WithField("error", err).Error("Error getting place detail")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+func getPlacePhotosHandler(w http.ResponseWriter, r *http.Request) {
+	placeId, err := strconv.ParseUint(mux.Vars(r)["place"], 10, 64)
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	place, err := Dao.PlacesDB.GetPlaceById(uint(placeId))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if place == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	photos, err := GetPlacePhotos(*place)
+	if err != nil {
+		log.WithField("error", err).Error("Error getting place photos")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(photos)
+}
+
+func createSessionHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	radius, err := getRadiusParam(r.URL.Query())
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	quorum, err := strconv.ParseUint(getStringParamWithDefault(r.URL.Query(), "quorum", "0"), 10, 64)
+	if err != nil || quorum == 1 {
+		log.WithField("quorum", quorum).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	coordinates, err := getCoordinatesParamRequired(r.URL.Query(), "coordinates")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	filter, err := getSearchFilterParams(r.URL.Query())
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	session, err := CreateSession(deviceId, coordinates, radius, filter.Type, uint(quorum))
+	if err != nil {
+		log.WithField("error", err).Error("Error creating session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+func joinSessionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	session, err := JoinSession(vars["code"], vars["device"])
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+func getSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := GetSession(mux.Vars(r)["code"])
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+func getSessionDeckHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	size, err := strconv.Atoi(getStringParamWithDefault(r.URL.Query(), "size", strconv.Itoa(DefaultDeckSize)))
+	if err != nil || size < 1 || size > MaxDeckSize {
+		log.WithField("size", size).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var cursor *pageCursor
+	if value := getStringParamWithDefault(r.URL.Query(), "cursor", ""); value != "" {
+		decoded, err := Cursors.Decode(value)
+		if err != nil {
+			writeSearchParamsError(w, err)
+			return
+		}
+		cursor = &decoded
+	}
+
+	deck, err := FindSessionDeck(mux.Vars(r)["code"], deviceId, size, cursor)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deck)
+}
+
+func saveSessionLikeHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	placeId, err := strconv.ParseUint(vars["place"], 10, 64)
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	isLiked, err := strconv.ParseBool(vars["liked"])
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	placeExist, err := Dao.PlacesDB.PlaceExistsById(uint(placeId))
+	if err != nil {
+		log.WithField("error", err).Error("Can't find place")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !placeExist {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	result, err := SaveSessionLike(vars["code"], uint(placeId), vars["device"], isLiked)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func getAccountHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	account, err := GetAccount(deviceId)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+func createAccountHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	account, err := CreateAccount(deviceId)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+func linkDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	linkCode, err := getStringParamRequired(r.URL.Query(), "code")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	account, err := LinkDevice(deviceId, linkCode)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+func writeAccountError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrAccountNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case ErrDeviceLinked:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		log.WithField("error", err).Error("Error processing account request")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func createApiClientHandler(w http.ResponseWriter, r *http.Request) {
+	var request ApiClientRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Name == "" || len(request.Scopes) == 0 {
+		log.WithField("error", err).Error("Incorrect api client")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, scope := range request.Scopes {
+		if !isKnownScope(scope) {
+			log.WithField("scope", scope).Error("Incorrect api client scope")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	var expireDate time.Time
+	if request.ExpiresAt != nil {
+		expireDate = *request.ExpiresAt
+	}
+
+	client, err := CreateApiClient(request.Name, request.Scopes, expireDate)
+	if err == dao.ErrApiClientExists {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.WithField("error", err).Error("Error creating api client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(client)
+}
+
+func getApiClientsHandler(w http.ResponseWriter, r *http.Request) {
+	clients, err := GetApiClients()
+	if err != nil {
+		log.WithField("error", err).Error("Error getting api clients")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients)
+}
+
+func revokeApiClientHandler(w http.ResponseWriter, r *http.Request) {
+	clientId, err := strconv.ParseUint(mux.Vars(r)["client"], 10, 64)
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	isRevoked, err := Dao.ApiClientsDB.RevokeClient(uint(clientId))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !isRevoked {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	log.WithFields(log.Fields{
+		"clientId":  clientId,
+		"revokedBy": ApiClientFromContext(r.Context()).Name,
+	}).Info("Api client revoked")
+	w.WriteHeader(http.StatusOK)
+}
+
+// mapsUsageHandler report Maps API usage between from and to days, last 30 days by default
+func mapsUsageHandler(prices MapsPrices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		from, err := time.Parse(usageDayLayout, getStringParamWithDefault(r.URL.Query(), "from", today.AddDate(0, 0, -29).Format(usageDayLayout)))
+		if err != nil {
+			log.WithField("error", err).Error("Incorrect input data")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		to, err := time.Parse(usageDayLayout, getStringParamWithDefault(r.URL.Query(), "to", today.Format(usageDayLayout)))
+		if err != nil || to.Before(from) {
+			log.WithField("error", err).Error("Incorrect input data")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		report, err := GetMapsUsageReport(from, to, prices)
+		if err != nil {
+			log.WithField("error", err).Error("Error getting maps usage")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrSessionNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case ErrNotSessionMember:
+		w.WriteHeader(http.StatusForbidden)
+	case ErrInvalidPageCursor:
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		log.WithField("error", err).Error("Error processing session request")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// eventsHandler stream events for device as Server-Sent Events
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	deviceId, err := getStringParamRequired(r.URL.Query(), "device")
+	if err != nil {
+		log.WithField("error", err).Error("Incorrect input data")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error("Streaming is not supported")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	events := Events.Subscribe(deviceId)
+	defer Events.Unsubscribe(deviceId, events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
 func getStringParamRequired(values url.Values, paramName string) (string, error) {
 	paramValues, hasParam := values[paramName]
 	var value string
@@ -119,15 +768,69 @@ func getCoordinatesParam(values url.Values, paramName string) (maps.LatLng, erro
 	return coordinates, nil
 }
 
-// BasicAuth basic auth wrapper for handlers, see https://stackoverflow.com/questions/21936332/
-func BasicAuth(handler http.HandlerFunc, username, password string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		user, pass, ok := r.BasicAuth()
-		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Hungries API"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+// getCoordinatesParamRequired read lat,lng param, error when it's missing or malformed
+func getCoordinatesParamRequired(values url.Values, paramName string) (maps.LatLng, error) {
+	value, err := getStringParamRequired(values, paramName)
+	if err != nil {
+		return maps.LatLng{}, err
+	}
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return maps.LatLng{}, errors.New("incorrect param " + paramName)
+	}
+	latitude, latErr := strconv.ParseFloat(parts[0], 64)
+	longitude, lngErr := strconv.ParseFloat(parts[1], 64)
+	if latErr != nil || lngErr != nil || math.Abs(latitude) > 90 || math.Abs(longitude) > 180 {
+		return maps.LatLng{}, errors.New("incorrect param " + paramName)
+	}
+	return maps.LatLng{Lat: latitude, Lng: longitude}, nil
+}
+
+// getRadiusParam read required radius in meters, from 1 to MaxSearchRadius
+func getRadiusParam(values url.Values) (uint, error) {
+	radius, err := strconv.ParseUint(getStringParamWithDefault(values, "radius", ""), 10, 64)
+	if err != nil || radius == 0 || radius > MaxSearchRadius {
+		return 0, errors.New("incorrect param radius")
+	}
+	return uint(radius), nil
+}
+
+// getSearchFilterParams read optional type, keyword, opennow, minprice and maxprice params
+func getSearchFilterParams(values url.Values) (dao.SearchFilter, error) {
+	filter := dao.DefaultSearchFilter()
+	var err error
+	if placeType := getStringParamWithDefault(values, "type", ""); placeType != "" {
+		filter.Type, err = maps.ParsePlaceType(placeType)
+		if err != nil {
+			return filter, err
 		}
-		handler(w, r)
 	}
+	filter.Keyword = getStringParamWithDefault(values, "keyword", "")
+	filter.OpenNow, err = strconv.ParseBool(getStringParamWithDefault(values, "opennow", "false"))
+	if err != nil {
+		return filter, errors.New("incorrect param opennow")
+	}
+	filter.MinPrice, err = strconv.Atoi(getStringParamWithDefault(values, "minprice", strconv.Itoa(dao.MinPriceLevel)))
+	if err != nil || filter.MinPrice < dao.MinPriceLevel || filter.MinPrice > dao.MaxPriceLevel {
+		return filter, errors.New("incorrect param minprice")
+	}
+	filter.MaxPrice, err = strconv.Atoi(getStringParamWithDefault(values, "maxprice", strconv.Itoa(dao.MaxPriceLevel)))
+	if err != nil || filter.MaxPrice < filter.MinPrice || filter.MaxPrice > dao.MaxPriceLevel {
+		return filter, errors.New("incorrect param maxprice")
+	}
+	filter.OpenAt, err = getTimeParam(values, "openAt")
+	return filter, err
+}
+
+// getTimeParam read optional RFC 3339 time param, zero time if it's missing
+func getTimeParam(values url.Values, paramName string) (time.Time, error) {
+	value := getStringParamWithDefault(values, paramName, "")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("incorrect param " + paramName)
+	}
+	return t, nil
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const photoJpegQuality = 80
+const photoWebpQuality = 75
+
+// size of the image blurhash and dominant colour are calculated from
+const placeholderSourceWidth = 32
+
+// photoVariant size of photo shown in the app, photo is scaled down to fit into it
+type photoVariant struct {
+	// suffix of the photo name in storage, names differ from the original unresized photo named by place id,
+	// so existing photos are replaced by variants
+	suffix    string
+	maxWidth  int
+	maxHeight int
+}
+
+var cardPhotoVariant = photoVariant{suffix: "-card", maxWidth: MaxPhotoWidth, maxHeight: MaxPhotoHeight}
+var thumbnailPhotoVariant = photoVariant{suffix: "-thumb", maxWidth: 150, maxHeight: 200}
+
+// photoFormat encoding of photo variants, extension of the name in storage sets its content type
+type photoFormat struct {
+	extension string
+	encode    func(img image.Image) ([]byte, error)
+}
+
+var jpegPhotoFormat = photoFormat{extension: ".jpg", encode: encodeJpeg}
+var webpPhotoFormat = photoFormat{extension: ".webp", encode: encodeWebp}
+
+// encodedPhoto variant of the photo in every format
+type encodedPhoto struct {
+	jpeg []byte
+	webp []byte
+}
+
+// processedPhoto photo variants and placeholders shown while they load
+type processedPhoto struct {
+	card      encodedPhoto
+	thumbnail encodedPhoto
+	blurhash  string
+	// color dominant colour in #rrggbb format
+	color string
+}
+
+// processPhoto decode jpeg, png or webp photo, resize it to all variants and calculate placeholders
+func processPhoto(data io.Reader) (processedPhoto, error) {
+	source, _, err := image.Decode(data)
+	if err != nil {
+		return processedPhoto{}, err
+	}
+	card, err := encodePhotoVariant(source, cardPhotoVariant)
+	if err != nil {
+		return processedPhoto{}, err
+	}
+	thumbnail, err := encodePhotoVariant(source, thumbnailPhotoVariant)
+	if err != nil {
+		return processedPhoto{}, err
+	}
+	small := resizeToFit(source, placeholderSourceWidth, placeholderSourceWidth)
+	return processedPhoto{
+		card:      card,
+		thumbnail: thumbnail,
+		blurhash:  encodeBlurhash(small),
+		color:     averageColor(small),
+	}, nil
+}
+
+// encodePhotoVariant resize photo to variant and encode it in every format
+func encodePhotoVariant(source image.Image, variant photoVariant) (encodedPhoto, error) {
+	resized := resizeToFit(source, variant.maxWidth, variant.maxHeight)
+	jpegData, err := jpegPhotoFormat.encode(resized)
+	if err != nil {
+		return encodedPhoto{}, err
+	}
+	webpData, err := webpPhotoFormat.encode(resized)
+	if err != nil {
+		return encodedPhoto{}, err
+	}
+	return encodedPhoto{jpeg: jpegData, webp: webpData}, nil
+}
+
+// resizeToFit scale image down keeping aspect ratio, smaller images are not scaled up
+func resizeToFit(source image.Image, maxWidth int, maxHeight int) image.Image {
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxWidth && height <= maxHeight {
+		return source
+	}
+	if width*maxHeight > height*maxWidth {
+		height = max(1, height*maxWidth/width)
+		width = maxWidth
+	} else {
+		width = max(1, width*maxHeight/height)
+		height = maxHeight
+	}
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(result, result.Bounds(), source, bounds, draw.Src, nil)
+	return result
+}
+
+func encodeJpeg(img image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: photoJpegQuality})
+	return buffer.Bytes(), err
+}
+
+func encodeWebp(img image.Image) ([]byte, error) {
+	return webp.EncodeRGB(img, photoWebpQuality)
+}
+
+func averageColor(img image.Image) string {
+	bounds := img.Bounds()
+	var r, g, b, count uint64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pr, pg, pb, _ := img.At(x, y).RGBA()
+			r += uint64(pr >> 8)
+			g += uint64(pg >> 8)
+			b += uint64(pb >> 8)
+			count++
+		}
+	}
+	if count == 0 {
+		return "#000000"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", r/count, g/count, b/count)
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
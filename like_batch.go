@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+const MaxLikeBatchSize = 500
+
+// SaveLikeBatch save swipes made offline with liked and swipedAt set, the latest swipe of a place wins
+// no matter when it's submitted. Swipe times in the future are treated as now, so a wrong client clock
+// can't make a swipe permanent
+func SaveLikeBatch(deviceId string, swipes []LikeSwipeRequest) ([]LikeSwipeResultResponse, error) {
+	now := time.Now()
+	var likeSwipes []dao.LikeSwipe
+	for _, swipe := range swipes {
+		swipeDate := *swipe.SwipedAt
+		if swipeDate.After(now) {
+			swipeDate = now
+		}
+		likeSwipe := dao.LikeSwipe{
+			PlaceId:   swipe.PlaceId,
+			IsLiked:   *swipe.Liked,
+			SwipeDate: swipeDate,
+		}
+		if swipe.Location != nil {
+			likeSwipe.Location = &maps.LatLng{Lat: swipe.Location.Latitude, Lng: swipe.Location.Longitude}
+		}
+		likeSwipes = append(likeSwipes, likeSwipe)
+	}
+	results, err := Dao.LikesDB.SaveLikes(deviceId, likeSwipes)
+	if err != nil {
+		return nil, err
+	}
+	response := []LikeSwipeResultResponse{}
+	for _, result := range results {
+		response = append(response, LikeSwipeResultResponse{
+			PlaceId: result.PlaceId,
+			Status:  result.Status,
+		})
+	}
+	return response, nil
+}
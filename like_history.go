@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+const DefaultLikeHistoryLimit = 50
+const MaxLikeHistoryLimit = 500
+
+// UndoLastSwipe revert the last like change of the device and return the place with restored like,
+// nil if there is nothing to undo
+func UndoLastSwipe(deviceId string, coordinates maps.LatLng) (*PlaceResponse, error) {
+	event, err := Dao.LikesDB.UndoLastLike(deviceId)
+	if err != nil || event == nil {
+		return nil, err
+	}
+	place, err := Dao.PlacesDB.GetPlaceById(event.PlaceId)
+	if err != nil {
+		return nil, err
+	}
+	if place == nil {
+		return nil, fmt.Errorf("place %d of undone like not found", event.PlaceId)
+	}
+	likes := map[uint]bool{}
+	if event.IsLiked.Valid {
+		likes[place.Id] = event.IsLiked.Bool
+	}
+	restored := placeDBtoResponse([]dao.PlaceDB{*place}, likes, coordinates)[0]
+	return &restored, nil
+}
+
+// GetLikeHistory get like changes of the device, newest first
+func GetLikeHistory(deviceId string, limit uint) ([]LikeEventResponse, error) {
+	events, err := Dao.LikesDB.GetLikeHistory(deviceId, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []LikeEventResponse{}
+	for _, event := range events {
+		result = append(result, LikeEventResponse{
+			Id:              event.Id,
+			PlaceId:         event.PlaceId,
+			Action:          event.Action,
+			IsLiked:         nullBoolToPtr(event.IsLiked),
+			PreviousIsLiked: nullBoolToPtr(event.PreviousIsLiked),
+			IsUndone:        event.IsUndone,
+			Date:            event.EventDate,
+			SwipedAt:        nullTimeToPtr(event.SwipeDate),
+		})
+	}
+	return result, nil
+}
+
+func nullTimeToPtr(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	var valueCopy = value.Time
+	return &valueCopy
+}
@@ -4,26 +4,41 @@ import (
 	"cloud.google.com/go/storage"
 	"context"
 	"database/sql"
+	"errors"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/api/option"
-	"googlemaps.github.io/maps"
 	"hungries-api/dao"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
+	// place time zones are loaded even where the system has no zone database
+	_ "time/tzdata"
 )
 
+// number of concurrent photo uploads
+const photoUploadWorkers = 4
+
 var db *sql.DB
 var Dao *DaoEnv
 
 type DaoEnv struct {
-	PlacesDB     dao.PlaceDbService
-	LikesDB      dao.LikeDBService
-	MapsApi      dao.GoogleMapsAPIService
-	CloudStorage dao.GoogleCloudStorageService
+	PlacesDB          dao.PlaceDbService
+	PlacePhotosDB     dao.PlacePhotoDBService
+	LikesDB           dao.LikeDBService
+	SearchAreasDB     dao.SearchAreaDBService
+	SessionsDB        dao.SessionDBService
+	ApiClientsDB      dao.ApiClientDBService
+	MapsUsageDB       dao.MapsUsageDBService
+	DeviceTokensDB    dao.DeviceTokenDBService
+	AccountsDB        dao.AccountDBService
+	RecommendationsDB dao.RecommendationDBService
+	MapsApi           dao.PlaceProvider
+	PhotoStorage      dao.PhotoStorage
 }
 
 func initDB(dataSourceName string) error {
@@ -35,27 +50,215 @@ func initDB(dataSourceName string) error {
 	return db.Ping()
 }
 
+// initPlaceProvider create place provider by name
+func initPlaceProvider(name string) (dao.PlaceProvider, error) {
+	switch name {
+	case "google":
+		return dao.NewGoogleMapsAPIService(checkEnvVariable("GOOGLE_MAPS_API_KEY"))
+	case "osm":
+		return &dao.OsmPlaceProvider{PlacesDB: &dao.PlaceDbService{DB: db}}, nil
+	case "fixture":
+		return dao.NewFixturePlaceProvider(getEnvVariableWithDefault("FIXTURE_PLACES_PATH", "fixtures/places.json"))
+	default:
+		return nil, errors.New("unknown place provider " + name)
+	}
+}
+
+// initPhotoStorage create photo storage by name
+func initPhotoStorage(name string) (dao.PhotoStorage, error) {
+	switch name {
+	case "gcs":
+		storageKeyJson := checkEnvVariable("STORAGE_KEY_JSON")
+		cloudStorageClient, err := storage.NewClient(context.Background(), option.WithCredentialsJSON([]byte(storageKeyJson)))
+		if err != nil {
+			return nil, err
+		}
+		return &dao.GoogleCloudStorageService{
+			StorageClient: cloudStorageClient,
+			BucketName:    getEnvVariableWithDefault("PHOTO_BUCKET", "hungries-place-photo"),
+		}, nil
+	case "local":
+		return &dao.LocalPhotoStorage{
+			Dir:     getEnvVariableWithDefault("PHOTO_DIR", "photos"),
+			BaseUrl: os.Getenv("PUBLIC_URL"),
+		}, nil
+	default:
+		return nil, errors.New("unknown photo storage " + name)
+	}
+}
+
+// initEventHub create event hub with backend by name
+func initEventHub(name string, databaseUrl string) (*EventHub, error) {
+	switch name {
+	case "local":
+		return NewEventHub(&LocalEventBackend{})
+	case "postgres":
+		return NewEventHub(&PostgresEventBackend{
+			Notifications: &dao.NotificationService{DB: db, DatabaseUrl: databaseUrl},
+		})
+	default:
+		return nil, errors.New("unknown events backend " + name)
+	}
+}
+
 func main() {
 	// check required variables
 	port := checkEnvVariable("PORT")
 	databaseUrl := checkEnvVariable("DATABASE_URL")
-	googleMapsApiKey := checkEnvVariable("GOOGLE_MAPS_API_KEY")
-	storageKeyJson := checkEnvVariable("STORAGE_KEY_JSON")
-	apiUsername := checkEnvVariable("API_USERNAME")
-	apiPassword := checkEnvVariable("API_PASSWORD")
+
+	// optional variables
+	apiUsername := getEnvVariableWithDefault("API_USERNAME", "")
+	apiPassword := getEnvVariableWithDefault("API_PASSWORD", "")
+	adminApiKey := getEnvVariableWithDefault("ADMIN_API_KEY", "")
+	deviceTokenSecret := getEnvVariableWithDefault("DEVICE_TOKEN_SECRET", "")
+	pageCursorSecret := getEnvVariableWithDefault("PAGE_CURSOR_SECRET", "")
+	if pageCursorSecret == "" {
+		log.Fatal("Incorrect $PAGE_CURSOR_SECRET environment variable, cursors must be signed with the same secret on all instances")
+	}
+	requireDeviceToken, err := strconv.ParseBool(getEnvVariableWithDefault("REQUIRE_DEVICE_TOKEN", "false"))
+	if err != nil || (requireDeviceToken && deviceTokenSecret == "") {
+		log.Fatal("Incorrect $REQUIRE_DEVICE_TOKEN environment variable, it needs $DEVICE_TOKEN_SECRET")
+	}
+	if deviceTokenSecret != "" && !requireDeviceToken {
+		log.Warn("Device tokens aren't required, legacy device ids can be registered by anyone who knows them until $REQUIRE_DEVICE_TOKEN is true")
+	}
+	// Basic Auth is accepted only when enabled explicitly with its sunset date
+	var legacyBasicAuthUntil time.Time
+	if value := getEnvVariableWithDefault("LEGACY_BASIC_AUTH_UNTIL", ""); value != "" {
+		legacyBasicAuthUntil, err = time.Parse("2006-01-02", value)
+		if err != nil || apiUsername == "" || apiPassword == "" {
+			log.Fatal("Incorrect $LEGACY_BASIC_AUTH_UNTIL environment variable, it needs $API_USERNAME and $API_PASSWORD")
+		}
+		if legacyBasicAuthUntil.Before(time.Now()) {
+			log.WithField("sunset", value).Warn("Legacy Basic Auth is past its sunset and is rejected")
+		}
+	} else if apiUsername != "" || apiPassword != "" {
+		log.Warn("$API_USERNAME and $API_PASSWORD are ignored, set $LEGACY_BASIC_AUTH_UNTIL to accept Basic Auth until that date")
+	}
+	searchCacheMaxAgeHours, err := strconv.Atoi(getEnvVariableWithDefault("SEARCH_CACHE_MAX_AGE_HOURS", "72"))
+	if err != nil {
+		log.Fatal("Incorrect $SEARCH_CACHE_MAX_AGE_HOURS environment variable")
+	}
+	SearchCacheMaxAge = time.Duration(searchCacheMaxAgeHours) * time.Hour
+	placeProvider := getEnvVariableWithDefault("PLACE_PROVIDER", "google")
+	IsSearchAreaSaved = placeProvider == "google"
+	eventsBackend := getEnvVariableWithDefault("EVENTS_BACKEND", "postgres")
+	photoStorageName := getEnvVariableWithDefault("PHOTO_STORAGE", "gcs")
+	placeRefreshMaxAgeDays, err := strconv.Atoi(getEnvVariableWithDefault("PLACE_REFRESH_MAX_AGE_DAYS", "30"))
+	if err != nil || placeRefreshMaxAgeDays <= 0 {
+		log.Fatal("Incorrect $PLACE_REFRESH_MAX_AGE_DAYS environment variable")
+	}
+	placeRefreshIntervalMinutes, err := strconv.Atoi(getEnvVariableWithDefault("PLACE_REFRESH_INTERVAL_MINUTES", "60"))
+	if err != nil || placeRefreshIntervalMinutes <= 0 {
+		log.Fatal("Incorrect $PLACE_REFRESH_INTERVAL_MINUTES environment variable")
+	}
+	recommendationsRefreshMinutes, err := strconv.Atoi(getEnvVariableWithDefault("RECOMMENDATIONS_REFRESH_MINUTES", "60"))
+	if err != nil || recommendationsRefreshMinutes <= 0 {
+		log.Fatal("Incorrect $RECOMMENDATIONS_REFRESH_MINUTES environment variable")
+	}
+
+	rateLimitBackendName := getEnvVariableWithDefault("RATE_LIMIT_BACKEND", "local")
+	clientIpHeader := getEnvVariableWithDefault("CLIENT_IP_HEADER", "")
+	clientRequestsPerMinute, err := strconv.ParseFloat(getEnvVariableWithDefault("RATE_LIMIT_CLIENT_PER_MINUTE", "6000"), 64)
+	if err != nil || clientRequestsPerMinute < 0 {
+		log.Fatal("Incorrect $RATE_LIMIT_CLIENT_PER_MINUTE environment variable")
+	}
+	deviceRequestsPerMinute, err := strconv.ParseFloat(getEnvVariableWithDefault("RATE_LIMIT_DEVICE_PER_MINUTE", "60"), 64)
+	if err != nil || deviceRequestsPerMinute < 0 {
+		log.Fatal("Incorrect $RATE_LIMIT_DEVICE_PER_MINUTE environment variable")
+	}
+	mapsBudgetPerMinute, err := strconv.ParseFloat(getEnvVariableWithDefault("MAPS_BUDGET_PER_MINUTE", "0"), 64)
+	if err != nil || mapsBudgetPerMinute < 0 {
+		log.Fatal("Incorrect $MAPS_BUDGET_PER_MINUTE environment variable")
+	}
+	mapsBudgetPerDay, err := strconv.ParseFloat(getEnvVariableWithDefault("MAPS_BUDGET_PER_DAY", "0"), 64)
+	if err != nil || mapsBudgetPerDay < 0 {
+		log.Fatal("Incorrect $MAPS_BUDGET_PER_DAY environment variable")
+	}
+
+	searchResponseCacheName := getEnvVariableWithDefault("SEARCH_RESPONSE_CACHE", "local")
+	searchResponseCacheMinutes, err := strconv.Atoi(getEnvVariableWithDefault("SEARCH_RESPONSE_CACHE_TTL_MINUTES", "30"))
+	if err != nil || searchResponseCacheMinutes <= 0 {
+		log.Fatal("SEARCH_RESPONSE_CACHE_TTL_MINUTES must be a positive number")
+	}
+	searchResponseCacheSize, err := strconv.Atoi(getEnvVariableWithDefault("SEARCH_RESPONSE_CACHE_SIZE", "2000"))
+	if err != nil || searchResponseCacheSize <= 0 {
+		log.Fatal("SEARCH_RESPONSE_CACHE_SIZE must be a positive number")
+	}
+	mapsPrices, err := ParseMapsPrices(getEnvVariableWithDefault("MAPS_PRICES", ""))
+	if err != nil {
+		log.Fatal("Incorrect $MAPS_PRICES environment variable")
+	}
 
 	// init DB and DAO objects
-	err := initDB(databaseUrl)
+	err = initDB(databaseUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mapsApi, err := initPlaceProvider(placeProvider)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rateLimitBackend, err := initRateLimitBackend(rateLimitBackendName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// other providers don't cost anything
+	if placeProvider == "google" {
+		MapsUsage = NewUsageRecorder()
+		mapsApi = &UsagePlaceProvider{Provider: mapsApi, Recorder: MapsUsage}
+	}
+	// maps budget is shared by all instances whatever backend requests are limited with
+	mapsBudgetBackend, err := initRateLimitBackend("postgres")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if placeProvider == "google" && (mapsBudgetPerMinute > 0 || mapsBudgetPerDay > 0) {
+		mapsApi = &BudgetPlaceProvider{
+			Provider:  mapsApi,
+			Backend:   mapsBudgetBackend,
+			PerMinute: mapsBudgetPerMinute,
+			PerDay:    mapsBudgetPerDay,
+		}
+	}
+	searchResponseCache, err := initSearchResponseCache(searchResponseCacheName, searchResponseCacheSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// cached responses don't take maps budget and aren't counted as maps api calls
+	if placeProvider == "google" && searchResponseCache != nil {
+		mapsApi = &CachingPlaceProvider{
+			Provider: mapsApi,
+			Cache:    searchResponseCache,
+			TTL:      time.Duration(searchResponseCacheMinutes) * time.Minute,
+		}
+	}
+	Cursors, err = NewPageCursors(pageCursorSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	photoStorage, err := initPhotoStorage(photoStorageName)
 	if err != nil {
 		log.Fatal(err)
 	}
-	mapsClient, _ := maps.NewClient(maps.WithAPIKey(googleMapsApiKey))
-	cloudStorageClient, _ := storage.NewClient(context.Background(), option.WithCredentialsJSON([]byte(storageKeyJson)))
 	Dao = &DaoEnv{
-		PlacesDB:     dao.PlaceDbService{DB: db},
-		LikesDB:      dao.LikeDBService{DB: db},
-		MapsApi:      dao.GoogleMapsAPIService{MapsClient: mapsClient},
-		CloudStorage: dao.GoogleCloudStorageService{StorageClient: cloudStorageClient},
+		PlacesDB:          dao.PlaceDbService{DB: db},
+		PlacePhotosDB:     dao.PlacePhotoDBService{DB: db},
+		LikesDB:           dao.LikeDBService{DB: db},
+		SearchAreasDB:     dao.SearchAreaDBService{DB: db},
+		SessionsDB:        dao.SessionDBService{DB: db},
+		ApiClientsDB:      dao.ApiClientDBService{DB: db},
+		MapsUsageDB:       dao.MapsUsageDBService{DB: db},
+		DeviceTokensDB:    dao.DeviceTokenDBService{DB: db},
+		AccountsDB:        dao.AccountDBService{DB: db},
+		RecommendationsDB: dao.RecommendationDBService{DB: db},
+		MapsApi:           mapsApi,
+		PhotoStorage:      photoStorage,
+	}
+
+	Events, err = initEventHub(eventsBackend, databaseUrl)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// run migrations
@@ -68,24 +271,206 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if adminApiKey != "" {
+		err = bootstrapAdminClient(adminApiKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// start background jobs
+	StartRateLimitCleanup(rateLimitBackend, rateLimitMaxIdle)
+	if rateLimitBackendName != "postgres" {
+		StartRateLimitCleanup(mapsBudgetBackend, rateLimitMaxIdle)
+	}
+	if MapsUsage != nil {
+		StartUsageFlushJob(MapsUsage, mapsUsageFlushInterval)
+	}
+	if searchResponseCache != nil {
+		StartSearchResponseCleanup(searchResponseCache)
+	}
+	StartPhotoUploaders(photoUploadWorkers)
+	StartRecommendationsJob(time.Duration(recommendationsRefreshMinutes) * time.Minute)
+	// other providers don't know google place ids
+	if placeProvider == "google" {
+		StartPlaceRefreshJob(
+			time.Duration(placeRefreshIntervalMinutes)*time.Minute,
+			time.Duration(placeRefreshMaxAgeDays)*24*time.Hour,
+		)
+	}
+
 	// set up routing
 	router := mux.NewRouter()
+	apiAuth := &ApiAuth{
+		LegacyUsername: apiUsername,
+		LegacyPassword: apiPassword,
+		LegacyUntil:    legacyBasicAuthUntil,
+		ClientIpHeader: clientIpHeader,
+	}
+	if clientRequestsPerMinute > 0 || deviceRequestsPerMinute > 0 {
+		apiAuth.RateLimiter = &RateLimiter{
+			Backend: rateLimitBackend,
+			Client:  RateLimit{PerMinute: clientRequestsPerMinute},
+			Device:  RateLimit{PerMinute: deviceRequestsPerMinute},
+		}
+	}
+	if deviceTokenSecret != "" {
+		apiAuth.DeviceTokens = &DeviceTokens{
+			Secret:     []byte(deviceTokenSecret),
+			Store:      &Dao.DeviceTokensDB,
+			IsRequired: requireDeviceToken,
+		}
+	}
 
 	router.HandleFunc(
 		"/places",
-		BasicAuth(findNearbyPlacesHandler, apiUsername, apiPassword),
+		apiAuth.Require(findNearbyPlacesHandler, ScopeReadPlaces),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/deck",
+		apiAuth.Require(getDeckHandler, ScopeReadPlaces),
 	).Methods(http.MethodGet)
 
 	router.HandleFunc(
 		"/places/liked",
-		BasicAuth(getLikedPlacesHandler, apiUsername, apiPassword),
+		apiAuth.Require(getLikedPlacesHandler, ScopeReadPlaces),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/recommendations",
+		apiAuth.Require(getRecommendationsHandler, ScopeReadPlaces),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/place/google/{googlePlaceId}",
+		apiAuth.Require(getPlaceByGoogleIdHandler, ScopeReadPlaces),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/place/{place:[0-9]+}",
+		apiAuth.Require(getPlaceHandler, ScopeReadPlaces),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/place/{place}/photos",
+		apiAuth.Require(getPlacePhotosHandler, ScopeReadPlaces),
 	).Methods(http.MethodGet)
 
 	router.HandleFunc(
 		"/place/{place}/like/{device}/{liked}",
-		BasicAuth(saveLikeHandler, apiUsername, apiPassword),
+		apiAuth.Require(saveLikeHandler, ScopeWriteLikes),
+	).Methods(http.MethodPost)
+
+	router.HandleFunc(
+		"/place/{place}/like/{device}",
+		apiAuth.Require(deleteLikeHandler, ScopeWriteLikes),
+	).Methods(http.MethodDelete)
+
+	router.HandleFunc(
+		"/likes/batch",
+		apiAuth.Require(saveLikeBatchHandler, ScopeWriteLikes),
+	).Methods(http.MethodPost)
+
+	router.HandleFunc(
+		"/likes/undo",
+		apiAuth.Require(undoLikeHandler, ScopeWriteLikes),
+	).Methods(http.MethodPost)
+
+	router.HandleFunc(
+		"/likes/history",
+		apiAuth.Require(getLikeHistoryHandler, ScopeReadPlaces),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/account",
+		apiAuth.Require(getAccountHandler, ScopeReadPlaces),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/account",
+		apiAuth.Require(createAccountHandler, ScopeWriteLikes),
+	).Methods(http.MethodPost)
+
+	router.HandleFunc(
+		"/account/link",
+		apiAuth.Require(linkDeviceHandler, ScopeWriteLikes),
+	).Methods(http.MethodPost)
+
+	router.HandleFunc(
+		"/session",
+		apiAuth.Require(createSessionHandler, ScopeWriteLikes),
+	).Methods(http.MethodPost)
+
+	router.HandleFunc(
+		"/session/{code}",
+		apiAuth.Require(getSessionHandler, ScopeReadPlaces),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/session/{code}/join/{device}",
+		apiAuth.Require(joinSessionHandler, ScopeWriteLikes),
+	).Methods(http.MethodPost)
+
+	router.HandleFunc(
+		"/session/{code}/deck",
+		apiAuth.Require(getSessionDeckHandler, ScopeReadPlaces),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/session/{code}/place/{place}/like/{device}/{liked}",
+		apiAuth.Require(saveSessionLikeHandler, ScopeWriteLikes),
 	).Methods(http.MethodPost)
 
+	router.HandleFunc(
+		"/events",
+		apiAuth.Require(eventsHandler, ScopeReadPlaces),
+	).Methods(http.MethodGet)
+
+	if apiAuth.DeviceTokens != nil {
+		router.HandleFunc(
+			"/device/register",
+			apiAuth.RequireClient(registerDeviceHandler(apiAuth.DeviceTokens), ScopeWriteLikes),
+		).Methods(http.MethodPost)
+
+		router.HandleFunc(
+			"/device/token/refresh",
+			apiAuth.RequireClient(refreshDeviceTokenHandler(apiAuth.DeviceTokens), ScopeWriteLikes),
+		).Methods(http.MethodPost)
+
+		router.HandleFunc(
+			"/device/token",
+			apiAuth.RequireClient(revokeDeviceTokenHandler(apiAuth.DeviceTokens), ScopeWriteLikes),
+		).Methods(http.MethodDelete)
+	}
+
+	router.HandleFunc(
+		"/admin/maps-usage",
+		apiAuth.RequireClient(mapsUsageHandler(mapsPrices), ScopeAdmin),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/admin/clients",
+		apiAuth.RequireClient(getApiClientsHandler, ScopeAdmin),
+	).Methods(http.MethodGet)
+
+	router.HandleFunc(
+		"/admin/clients",
+		apiAuth.RequireClient(createApiClientHandler, ScopeAdmin),
+	).Methods(http.MethodPost)
+
+	router.HandleFunc(
+		"/admin/clients/{client}",
+		apiAuth.RequireClient(revokeApiClientHandler, ScopeAdmin),
+	).Methods(http.MethodDelete)
+
+	if localStorage, ok := photoStorage.(*dao.LocalPhotoStorage); ok {
+		router.HandleFunc(
+			"/photos/{id}",
+			localPhotoHandler(localStorage),
+		).Methods(http.MethodGet)
+	}
+
 	http.ListenAndServe(":"+port, router)
 }
 
@@ -96,3 +481,11 @@ func checkEnvVariable(name string) string {
 	}
 	return value
 }
+
+func getEnvVariableWithDefault(name string, defaultValue string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+var ErrMapsBudgetExceeded = errors.New("maps api budget is used up")
+
+// BudgetPlaceProvider limits calls to place provider shared by all requests, calls over budget fail
+// with ErrMapsBudgetExceeded without reaching the provider
+type BudgetPlaceProvider struct {
+	Provider dao.PlaceProvider
+	// Backend shared by all API instances, so the budget is for the whole API and not for each instance
+	Backend RateLimitBackend
+	// PerMinute calls a minute, zero means no limit
+	PerMinute float64
+	// PerDay calls a day, zero means no limit
+	PerDay float64
+}
+
+var _ dao.PlaceProvider = (*BudgetPlaceProvider)(nil)
+
+func (p *BudgetPlaceProvider) FindNearbyPlaces(coordinates maps.LatLng, radius uint, pageToken string, filter dao.SearchFilter) (maps.PlacesSearchResponse, error) {
+	if err := p.takeCall(); err != nil {
+		return maps.PlacesSearchResponse{}, err
+	}
+	return p.Provider.FindNearbyPlaces(coordinates, radius, pageToken, filter)
+}
+
+func (p *BudgetPlaceProvider) GetPlaceInfoFromMaps(placeId string, fields []maps.PlaceDetailsFieldMask) (maps.PlaceDetailsResult, error) {
+	if err := p.takeCall(); err != nil {
+		return maps.PlaceDetailsResult{}, err
+	}
+	return p.Provider.GetPlaceInfoFromMaps(placeId, fields)
+}
+
+func (p *BudgetPlaceProvider) GetPhoto(photoReference string, width uint, height uint) (maps.PlacePhotoResponse, error) {
+	if err := p.takeCall(); err != nil {
+		return maps.PlacePhotoResponse{}, err
+	}
+	return p.Provider.GetPhoto(photoReference, width, height)
+}
+
+// takeCall take one call from minute and day budgets, the minute call is given back when the day budget is used up
+func (p *BudgetPlaceProvider) takeCall() error {
+	isAllowed, err := p.takeBudget("maps:minute", p.PerMinute, 60)
+	if err == nil && isAllowed {
+		isAllowed, err = p.takeBudget("maps:day", p.PerDay, 24*60*60)
+		if err == nil && !isAllowed && p.PerMinute > 0 {
+			p.Backend.ReturnToken("maps:minute", p.PerMinute)
+		}
+	}
+	if err != nil {
+		// budget can't be checked, don't block searches because of that
+		log.WithField("error", err).Error("Error checking maps api budget")
+		return nil
+	}
+	if !isAllowed {
+		log.Warn("Maps api budget is used up")
+		return ErrMapsBudgetExceeded
+	}
+	return nil
+}
+
+// takeBudget take a call from bucket of budget calls refilled over period seconds
+func (p *BudgetPlaceProvider) takeBudget(key string, budget float64, period float64) (bool, error) {
+	if budget <= 0 {
+		return true, nil
+	}
+	return p.Backend.TakeToken(key, budget/period, budget)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+// countingPlaceProvider counts calls that reached the provider
+type countingPlaceProvider struct {
+	calls int
+}
+
+func (p *countingPlaceProvider) FindNearbyPlaces(coordinates maps.LatLng, radius uint, pageToken string, filter dao.SearchFilter) (maps.PlacesSearchResponse, error) {
+	p.calls++
+	return maps.PlacesSearchResponse{}, nil
+}
+
+func (p *countingPlaceProvider) GetPlaceInfoFromMaps(placeId string, fields []maps.PlaceDetailsFieldMask) (maps.PlaceDetailsResult, error) {
+	p.calls++
+	return maps.PlaceDetailsResult{}, nil
+}
+
+func (p *countingPlaceProvider) GetPhoto(photoReference string, width uint, height uint) (maps.PlacePhotoResponse, error) {
+	p.calls++
+	return maps.PlacePhotoResponse{}, nil
+}
+
+func TestBudgetPlaceProvider(t *testing.T) {
+	backend, clock := newTestRateLimitBackend()
+	provider := &countingPlaceProvider{}
+	budget := &BudgetPlaceProvider{Provider: provider, Backend: backend, PerMinute: 2, PerDay: 3}
+	call := func() error {
+		_, err := budget.GetPlaceInfoFromMaps("place", nil)
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if err := call(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := call(); err != ErrMapsBudgetExceeded {
+		t.Fatalf("got %v over minute budget, want %v", err, ErrMapsBudgetExceeded)
+	}
+	clock.Advance(time.Minute)
+	if err := call(); err != nil {
+		t.Fatal(err)
+	}
+	if err := call(); err != ErrMapsBudgetExceeded {
+		t.Fatalf("got %v over day budget, want %v", err, ErrMapsBudgetExceeded)
+	}
+	if provider.calls != 3 {
+		t.Fatalf("provider got %d calls, want 3", provider.calls)
+	}
+	// call rejected by day budget gave its minute call back
+	if tokens := backend.buckets["maps:minute"].tokens; tokens != 1 {
+		t.Fatalf("minute budget has %v calls, want 1", tokens)
+	}
+}
+
+func TestBudgetPlaceProviderWithoutMinuteBudget(t *testing.T) {
+	backend, _ := newTestRateLimitBackend()
+	provider := &countingPlaceProvider{}
+	budget := &BudgetPlaceProvider{Provider: provider, Backend: backend, PerDay: 1}
+	budget.GetPhoto("photo", 100, 100)
+	if _, err := budget.GetPhoto("photo", 100, 100); err != ErrMapsBudgetExceeded {
+		t.Fatalf("got %v, want %v", err, ErrMapsBudgetExceeded)
+	}
+	if _, ok := backend.buckets["maps:minute"]; ok {
+		t.Fatal("minute budget is used without limit")
+	}
+}
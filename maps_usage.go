@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+const SkuNearbySearch = "nearby_search"
+const SkuPlaceDetails = "place_details"
+const SkuPlacePhoto = "place_photo"
+
+// how often counted usage is added to db totals
+const mapsUsageFlushInterval = time.Minute
+
+const UsageOutcomeOk = "ok"
+const UsageOutcomeNotFound = "not_found"
+const UsageOutcomeError = "error"
+
+// place details fields billed on top of basic data, see https://developers.google.com/maps/documentation/places/web-service/usage-and-billing
+var placeDetailsFieldCategories = map[string]string{
+	"formatted_phone_number":     "contact",
+	"international_phone_number": "contact",
+	"opening_hours":              "contact",
+	"website":                    "contact",
+	"price_level":                "atmosphere",
+	"rating":                     "atmosphere",
+	"review":                     "atmosphere",
+	"user_ratings_total":         "atmosphere",
+}
+
+// DefaultMapsPrices USD per 1000 calls by SKU, place details categories are priced as "place_details:<category>"
+var DefaultMapsPrices = MapsPrices{
+	SkuNearbySearch:                 32,
+	SkuPlaceDetails:                 17,
+	SkuPlaceDetails + ":contact":    3,
+	SkuPlaceDetails + ":atmosphere": 5,
+	SkuPlacePhoto:                   7,
+}
+
+// MapsPrices USD per 1000 calls by SKU
+type MapsPrices map[string]float64
+
+// ParseMapsPrices read price table from JSON object, SKUs missing in it have default prices
+func ParseMapsPrices(data string) (MapsPrices, error) {
+	prices := MapsPrices{}
+	for sku, price := range DefaultMapsPrices {
+		prices[sku] = price
+	}
+	if data == "" {
+		return prices, nil
+	}
+	var custom map[string]float64
+	if err := json.Unmarshal([]byte(data), &custom); err != nil {
+		return nil, err
+	}
+	for sku, price := range custom {
+		if price < 0 {
+			return nil, errors.New("negative price of " + sku)
+		}
+		prices[sku] = price
+	}
+	return prices, nil
+}
+
+// CallCost estimated cost of one call in USD
+func (p MapsPrices) CallCost(sku string, fieldMask string) float64 {
+	cost := p[sku]
+	if sku == SkuPlaceDetails {
+		categories := make(map[string]bool)
+		for _, field := range strings.Split(fieldMask, ",") {
+			if category, ok := placeDetailsFieldCategories[strings.Split(field, "/")[0]]; ok {
+				categories[category] = true
+			}
+		}
+		for category := range categories {
+			cost += p[sku+":"+category]
+		}
+	}
+	return cost / 1000
+}
+
+// usageKey kind of Maps API call counted in a day
+type usageKey struct {
+	day       string
+	sku       string
+	fieldMask string
+	outcome   string
+}
+
+// UsageRecorder counts Maps API calls and place cache hits in memory, they are added to db totals by flush
+type UsageRecorder struct {
+	mutex       sync.Mutex
+	calls       map[usageKey]int64
+	cacheHits   map[string]int64
+	cacheMisses map[string]int64
+}
+
+// MapsUsage recorder of Maps API usage, nil when usage isn't recorded
+var MapsUsage *UsageRecorder
+
+func NewUsageRecorder() *UsageRecorder {
+	return &UsageRecorder{
+		calls:       make(map[usageKey]int64),
+		cacheHits:   make(map[string]int64),
+		cacheMisses: make(map[string]int64),
+	}
+}
+
+// RecordCall count a Maps API call
+func (r *UsageRecorder) RecordCall(sku string, fieldMask string, err error) {
+	if r == nil {
+		return
+	}
+	outcome := UsageOutcomeOk
+	if err != nil && strings.Contains(err.Error(), dao.BusinessStatusNotFound) {
+		outcome = UsageOutcomeNotFound
+	} else if err != nil {
+		outcome = UsageOutcomeError
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls[usageKey{day: usageDay(time.Now()), sku: sku, fieldMask: fieldMask, outcome: outcome}]++
+}
+
+// RecordPlaceCache count places found in db and places that have to be requested from provider
+func (r *UsageRecorder) RecordPlaceCache(hits int, misses int) {
+	if r == nil {
+		return
+	}
+	day := usageDay(time.Now())
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cacheHits[day] += int64(hits)
+	r.cacheMisses[day] += int64(misses)
+}
+
+// flush add counted usage to db totals, counts are kept for the next flush if saving fails
+func (r *UsageRecorder) flush() error {
+	r.mutex.Lock()
+	calls, cacheHits, cacheMisses := r.calls, r.cacheHits, r.cacheMisses
+	r.calls = make(map[usageKey]int64)
+	r.cacheHits = make(map[string]int64)
+	r.cacheMisses = make(map[string]int64)
+	r.mutex.Unlock()
+
+	var usage []dao.MapsUsageDB
+	for key, count := range calls {
+		day, _ := time.Parse(usageDayLayout, key.day)
+		usage = append(usage, dao.MapsUsageDB{Day: day, Sku: key.sku, FieldMask: key.fieldMask, Outcome: key.outcome, Calls: count})
+	}
+	var cacheUsage []dao.PlaceCacheUsageDB
+	for dayKey, hits := range cacheHits {
+		day, _ := time.Parse(usageDayLayout, dayKey)
+		cacheUsage = append(cacheUsage, dao.PlaceCacheUsageDB{Day: day, Hits: hits, Misses: cacheMisses[dayKey]})
+	}
+	if len(usage) == 0 && len(cacheUsage) == 0 {
+		return nil
+	}
+	err := Dao.MapsUsageDB.AddUsage(usage, cacheUsage)
+	if err != nil {
+		r.mutex.Lock()
+		for key, count := range calls {
+			r.calls[key] += count
+		}
+		for day, hits := range cacheHits {
+			r.cacheHits[day] += hits
+			r.cacheMisses[day] += cacheMisses[day]
+		}
+		r.mutex.Unlock()
+	}
+	return err
+}
+
+// StartUsageFlushJob every interval add counted usage to db totals
+func StartUsageFlushJob(recorder *UsageRecorder, interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			recorder.flush()
+		}
+	}()
+}
+
+const usageDayLayout = "2006-01-02"
+
+// usageDay UTC day of the call
+func usageDay(t time.Time) string {
+	return t.UTC().Format(usageDayLayout)
+}
+
+// UsagePlaceProvider records every call of place provider
+type UsagePlaceProvider struct {
+	Provider dao.PlaceProvider
+	Recorder *UsageRecorder
+}
+
+var _ dao.PlaceProvider = (*UsagePlaceProvider)(nil)
+
+func (p *UsagePlaceProvider) FindNearbyPlaces(coordinates maps.LatLng, radius uint, pageToken string, filter dao.SearchFilter) (maps.PlacesSearchResponse, error) {
+	response, err := p.Provider.FindNearbyPlaces(coordinates, radius, pageToken, filter)
+	p.Recorder.RecordCall(SkuNearbySearch, "", err)
+	return response, err
+}
+
+func (p *UsagePlaceProvider) GetPlaceInfoFromMaps(placeId string, fields []maps.PlaceDetailsFieldMask) (maps.PlaceDetailsResult, error) {
+	response, err := p.Provider.GetPlaceInfoFromMaps(placeId, fields)
+	p.Recorder.RecordCall(SkuPlaceDetails, fieldMaskKey(fields), err)
+	return response, err
+}
+
+func (p *UsagePlaceProvider) GetPhoto(photoReference string, width uint, height uint) (maps.PlacePhotoResponse, error) {
+	response, err := p.Provider.GetPhoto(photoReference, width, height)
+	p.Recorder.RecordCall(SkuPlacePhoto, "", err)
+	return response, err
+}
+
+// fieldMaskKey sorted comma separated fields
+func fieldMaskKey(fields []maps.PlaceDetailsFieldMask) string {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = string(field)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// GetMapsUsageReport daily Maps API calls with estimated cost and place cache hit ratio between from and to days
+func GetMapsUsageReport(from time.Time, to time.Time, prices MapsPrices) (MapsUsageReportResponse, error) {
+	usage, err := Dao.MapsUsageDB.GetUsage(from, to)
+	if err != nil {
+		return MapsUsageReportResponse{}, err
+	}
+	cacheUsage, err := Dao.MapsUsageDB.GetPlaceCacheUsage(from, to)
+	if err != nil {
+		return MapsUsageReportResponse{}, err
+	}
+
+	report := MapsUsageReportResponse{Days: []MapsUsageDayResponse{}}
+	days := make(map[string]*MapsUsageDayResponse)
+	getDay := func(day time.Time) *MapsUsageDayResponse {
+		key := usageDay(day)
+		if _, ok := days[key]; !ok {
+			days[key] = &MapsUsageDayResponse{Day: key, Calls: []MapsUsageCallsResponse{}}
+		}
+		return days[key]
+	}
+	for _, u := range usage {
+		day := getDay(u.Day)
+		cost := float64(u.Calls) * prices.CallCost(u.Sku, u.FieldMask)
+		day.Calls = append(day.Calls, MapsUsageCallsResponse{
+			Sku:       u.Sku,
+			FieldMask: u.FieldMask,
+			Outcome:   u.Outcome,
+			Calls:     u.Calls,
+			Cost:      cost,
+		})
+		day.TotalCalls += u.Calls
+		day.Cost += cost
+		report.TotalCalls += u.Calls
+		report.Cost += cost
+	}
+	var totalHits, totalMisses int64
+	for _, u := range cacheUsage {
+		day := getDay(u.Day)
+		day.CacheHits = u.Hits
+		day.CacheMisses = u.Misses
+		day.CacheHitRatio = hitRatio(u.Hits, u.Misses)
+		totalHits += u.Hits
+		totalMisses += u.Misses
+	}
+	report.CacheHitRatio = hitRatio(totalHits, totalMisses)
+	for _, day := range days {
+		report.Days = append(report.Days, *day)
+	}
+	sort.Slice(report.Days, func(i, j int) bool {
+		return report.Days[i].Day < report.Days[j].Day
+	})
+	return report, nil
+}
+
+func hitRatio(hits int64, misses int64) *float64 {
+	if hits+misses == 0 {
+		return nil
+	}
+	ratio := float64(hits) / float64(hits+misses)
+	return &ratio
+}
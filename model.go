@@ -1,22 +1,186 @@
 package main
 
+import "time"
+
 type PlacesResponse struct {
 	Places        []PlaceResponse `json:"places"`
 	NextPageToken string          `json:"nextPageToken"`
 }
 
+type DeckResponse struct {
+	Places []PlaceResponse `json:"places"`
+	Cursor string          `json:"cursor"`
+}
+
 type PlaceResponse struct {
-	Id            uint             `json:"id"`
-	GooglePlaceId string           `json:"googlePlaceId"`
-	Name          string           `json:"name"`
-	Url           string           `json:"url"`
-	Location      LocationResponse `json:"location"`
-	Distance      uint             `json:"distance"`
-	PhotoUrl      *string          `json:"photoUrl"`
-	IsLiked       *bool            `json:"isLiked"`
+	Id                uint                  `json:"id"`
+	GooglePlaceId     string                `json:"googlePlaceId"`
+	OsmId             *string               `json:"osmId"`
+	Name              string                `json:"name"`
+	Url               string                `json:"url"`
+	Location          LocationResponse      `json:"location"`
+	Distance          uint                  `json:"distance"`
+	PhotoUrl          *string               `json:"photoUrl"`
+	PhotoThumbUrl     *string               `json:"photoThumbUrl"`
+	PhotoWebpUrl      *string               `json:"photoWebpUrl"`
+	PhotoThumbWebpUrl *string               `json:"photoThumbWebpUrl"`
+	PhotoBlurhash     *string               `json:"photoBlurhash"`
+	PhotoColor        *string               `json:"photoColor"`
+	IsLiked           *bool                 `json:"isLiked"`
+	BusinessStatus    string                `json:"businessStatus"`
+	Types             []string              `json:"types"`
+	PriceLevel        *int                  `json:"priceLevel"`
+	Rating            *float64              `json:"rating"`
+	UserRatingsTotal  *int                  `json:"userRatingsTotal"`
+	Address           *string               `json:"address"`
+	Phone             *string               `json:"phone"`
+	Website           *string               `json:"website"`
+	OpeningHours      *OpeningHoursResponse `json:"openingHours"`
+	IsOpenNow         *bool                 `json:"isOpenNow"`
+	ClosesAt          *time.Time            `json:"closesAt"`
+	Score             *float64              `json:"score,omitempty"`
+}
+
+// PlaceDetailResponse single place with aggregate likes of all users,
+// distance is null when the request has no coordinates
+type PlaceDetailResponse struct {
+	PlaceResponse
+	Distance     *uint `json:"distance"`
+	LikeCount    uint  `json:"likeCount"`
+	DislikeCount uint  `json:"dislikeCount"`
+}
+
+// LikeEventResponse change of like, isLiked and previousIsLiked are null when there was no like
+type LikeEventResponse struct {
+	Id              uint       `json:"id"`
+	PlaceId         uint       `json:"placeId"`
+	Action          string     `json:"action"`
+	IsLiked         *bool      `json:"isLiked"`
+	PreviousIsLiked *bool      `json:"previousIsLiked"`
+	IsUndone        bool       `json:"isUndone"`
+	Date            time.Time  `json:"date"`
+	SwipedAt        *time.Time `json:"swipedAt"`
+}
+
+// LikeSwipeRequest swipe made offline, liked and swipedAt are required, location of the device is optional
+type LikeSwipeRequest struct {
+	PlaceId  uint              `json:"placeId"`
+	Liked    *bool             `json:"liked"`
+	SwipedAt *time.Time        `json:"swipedAt"`
+	Location *LocationResponse `json:"location,omitempty"`
+}
+
+// LikeSwipeResultResponse status is applied, stale when the place was swiped later or unknown_place
+type LikeSwipeResultResponse struct {
+	PlaceId uint   `json:"placeId"`
+	Status  string `json:"status"`
+}
+
+// PlacePhotoResponse photo of the place gallery, attributions are html that must be shown with the photo
+type PlacePhotoResponse struct {
+	Url          string   `json:"url"`
+	ThumbUrl     *string  `json:"thumbUrl"`
+	WebpUrl      *string  `json:"webpUrl"`
+	ThumbWebpUrl *string  `json:"thumbWebpUrl"`
+	Blurhash     *string  `json:"blurhash"`
+	Color        *string  `json:"color"`
+	Width        int      `json:"width"`
+	Height       int      `json:"height"`
+	Attributions []string `json:"attributions"`
+}
+
+type OpeningHoursResponse struct {
+	Periods     []OpeningPeriodResponse `json:"periods"`
+	WeekdayText []string                `json:"weekdayText"`
+}
+
+// OpeningPeriodResponse close is null for places open 24/7
+type OpeningPeriodResponse struct {
+	Open  OpeningTimeResponse  `json:"open"`
+	Close *OpeningTimeResponse `json:"close"`
+}
+
+// OpeningTimeResponse day from 0 for Sunday to 6, time in hhmm format in place's time zone
+type OpeningTimeResponse struct {
+	Day  int    `json:"day"`
+	Time string `json:"time"`
 }
 
 type LocationResponse struct {
 	Latitude  float64 `json:"lat"`
 	Longitude float64 `json:"long"`
 }
+
+// AccountResponse account with devices linked to it, linkCode links another device to the account,
+// it's returned only when the account is created or requested with POST
+type AccountResponse struct {
+	Id       uint     `json:"id"`
+	LinkCode string   `json:"linkCode,omitempty"`
+	Devices  []string `json:"devices"`
+}
+
+// ApiClientRequest new API client, expiresAt is optional
+type ApiClientRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// ApiClientResponse key is returned only when the client is created
+type ApiClientResponse struct {
+	Id        uint       `json:"id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	IsRevoked bool       `json:"isRevoked"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// DeviceTokenResponse token is sent in X-Device-Token header with requests of the device
+type DeviceTokenResponse struct {
+	DeviceId  string    `json:"deviceId"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type SessionResponse struct {
+	Code        string           `json:"code"`
+	Location    LocationResponse `json:"location"`
+	Radius      uint             `json:"radius"`
+	PlaceType   string           `json:"type"`
+	Quorum      uint             `json:"quorum"`
+	MemberCount uint             `json:"memberCount"`
+	Matches     []PlaceResponse  `json:"matches"`
+}
+
+type SessionLikeResponse struct {
+	IsMatch bool           `json:"isMatch"`
+	Match   *PlaceResponse `json:"match"`
+}
+
+// MapsUsageReportResponse Maps API calls with estimated cost in USD, cache hit ratio is null without searches
+type MapsUsageReportResponse struct {
+	Days          []MapsUsageDayResponse `json:"days"`
+	TotalCalls    int64                  `json:"totalCalls"`
+	Cost          float64                `json:"cost"`
+	CacheHitRatio *float64               `json:"cacheHitRatio"`
+}
+
+type MapsUsageDayResponse struct {
+	Day           string                   `json:"day"`
+	Calls         []MapsUsageCallsResponse `json:"calls"`
+	TotalCalls    int64                    `json:"totalCalls"`
+	Cost          float64                  `json:"cost"`
+	CacheHits     int64                    `json:"cacheHits"`
+	CacheMisses   int64                    `json:"cacheMisses"`
+	CacheHitRatio *float64                 `json:"cacheHitRatio"`
+}
+
+type MapsUsageCallsResponse struct {
+	Sku       string  `json:"sku"`
+	FieldMask string  `json:"fieldMask"`
+	Outcome   string  `json:"outcome"`
+	Calls     int64   `json:"calls"`
+	Cost      float64 `json:"cost"`
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zsefvlol/timezonemapper"
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+const minutesInDay = 24 * 60
+const minutesInWeek = 7 * minutesInDay
+
+// openingStatus whether place is open at some instant and when it closes
+type openingStatus struct {
+	// IsKnown false if place has no opening hours or time zone
+	IsKnown bool
+	IsOpen  bool
+	// ClosesAt nil if place is closed or open 24/7
+	ClosesAt *time.Time
+}
+
+// openingPeriod period in minutes from the start of the week (Sunday 00:00) in place's local time,
+// close is after open and can be beyond the end of the week for periods wrapping to Sunday
+type openingPeriod struct {
+	open  int
+	close int
+}
+
+// loaded time zones by IANA name
+var timeZones sync.Map
+
+// getOpeningStatus evaluate place opening hours at instant t
+func getOpeningStatus(place dao.PlaceDB, t time.Time) openingStatus {
+	if place.OpeningHours == nil || len(place.OpeningHours.Periods) == 0 {
+		return openingStatus{}
+	}
+	location := placeLocation(place)
+	if location == nil {
+		return openingStatus{}
+	}
+	// google uses a single period opening on Sunday 00:00 without close time for places open 24/7
+	if isAlwaysOpen(place.OpeningHours) {
+		return openingStatus{IsKnown: true, IsOpen: true}
+	}
+	periods, ok := toOpeningPeriods(place.OpeningHours.Periods)
+	if !ok {
+		return openingStatus{}
+	}
+
+	local := t.In(location)
+	minuteOfDay := local.Hour()*60 + local.Minute()
+	now := int(local.Weekday())*minutesInDay + minuteOfDay
+	for _, p := range periods {
+		// period from the previous week can still last
+		for _, m := range []int{now, now + minutesInWeek} {
+			if m >= p.open && m < p.close {
+				closesIn := extendClose(periods, p.close) - m
+				if closesIn >= minutesInWeek {
+					return openingStatus{IsKnown: true, IsOpen: true}
+				}
+				// close is a wall clock time, it's not closesIn minutes later when clocks change in between
+				closeMinute := minuteOfDay + closesIn
+				closesAt := time.Date(local.Year(), local.Month(), local.Day()+closeMinute/minutesInDay,
+					closeMinute%minutesInDay/60, closeMinute%60, 0, 0, location).In(t.Location())
+				return openingStatus{IsKnown: true, IsOpen: true, ClosesAt: &closesAt}
+			}
+		}
+	}
+	return openingStatus{IsKnown: true, IsOpen: false}
+}
+
+// placeLocation time zone of the place, so daylight saving time changes are applied. Places saved before
+// time zones were stored get it by coordinates, fixed utc offset is used only when the zone is unknown there
+func placeLocation(place dao.PlaceDB) *time.Location {
+	name := place.TimeZone.String
+	if !place.TimeZone.Valid {
+		name = timezonemapper.LatLngToTimezoneString(place.Lat, place.Lng)
+	}
+	if name != "" {
+		if location, ok := timeZones.Load(name); ok {
+			return location.(*time.Location)
+		}
+		location, err := time.LoadLocation(name)
+		if err == nil {
+			timeZones.Store(name, location)
+			return location
+		}
+		log.WithFields(log.Fields{
+			"timeZone": name,
+			"error":    err,
+		}).Warn("Unknown place time zone")
+	}
+	if place.UtcOffset.Valid {
+		return time.FixedZone("", int(place.UtcOffset.Int32)*60)
+	}
+	return nil
+}
+
+// extendClose follow periods that open exactly when the previous one closes, e.g. 18:00-24:00 and 00:00-02:00
+func extendClose(periods []openingPeriod, close int) int {
+	end := close
+	for i := 0; i < len(periods); i++ {
+		extended := false
+		for _, p := range periods {
+			if p.open == end%minutesInWeek || p.open+minutesInWeek == end {
+				end += p.close - p.open
+				extended = true
+				break
+			}
+		}
+		if !extended {
+			break
+		}
+	}
+	return end
+}
+
+func isAlwaysOpen(hours *maps.OpeningHours) bool {
+	return len(hours.Periods) == 1 &&
+		hours.Periods[0].Close.Time == "" &&
+		hours.Periods[0].Open.Day == time.Sunday &&
+		hours.Periods[0].Open.Time == "0000"
+}
+
+func toOpeningPeriods(periods []maps.OpeningHoursPeriod) ([]openingPeriod, bool) {
+	var result []openingPeriod
+	for _, p := range periods {
+		open, ok := weekMinutes(p.Open)
+		if !ok {
+			return nil, false
+		}
+		close, ok := weekMinutes(p.Close)
+		if !ok {
+			return nil, false
+		}
+		// overnight period closing next day or next week
+		if close <= open {
+			close += minutesInWeek
+		}
+		result = append(result, openingPeriod{open: open, close: close})
+	}
+	return result, true
+}
+
+// weekMinutes minutes from the start of the week, time is in hhmm format
+func weekMinutes(openClose maps.OpeningHoursOpenClose) (int, bool) {
+	if len(openClose.Time) != 4 {
+		return 0, false
+	}
+	hhmm, err := strconv.Atoi(openClose.Time)
+	// 2400 is the end of the day, any later time is invalid
+	if err != nil || hhmm > 2400 || hhmm%100 >= 60 {
+		return 0, false
+	}
+	return int(openClose.Day)*minutesInDay + hhmm/100*60 + hhmm%100, true
+}
+
+// filterByOpeningHours keep places open at filter open at time or now for open now filter.
+// Places with unknown opening hours are removed
+func filterByOpeningHours(places []dao.PlaceDB, filter dao.SearchFilter) []dao.PlaceDB {
+	openAt := filter.OpenAt
+	if openAt.IsZero() {
+		if !filter.OpenNow {
+			return places
+		}
+		openAt = time.Now()
+	}
+	var result []dao.PlaceDB
+	for _, p := range places {
+		if getOpeningStatus(p, openAt).IsOpen {
+			result = append(result, p)
+		}
+	}
+	return result
+}
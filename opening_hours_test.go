@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+func berlinPlace(periods ...maps.OpeningHoursPeriod) dao.PlaceDB {
+	return dao.PlaceDB{
+		Lat:          52.52,
+		Lng:          13.405,
+		TimeZone:     sql.NullString{String: "Europe/Berlin", Valid: true},
+		OpeningHours: &maps.OpeningHours{Periods: periods},
+	}
+}
+
+func period(openDay time.Weekday, open string, closeDay time.Weekday, close string) maps.OpeningHoursPeriod {
+	return maps.OpeningHoursPeriod{
+		Open:  maps.OpeningHoursOpenClose{Day: openDay, Time: open},
+		Close: maps.OpeningHoursOpenClose{Day: closeDay, Time: close},
+	}
+}
+
+func mustParse(t *testing.T, value string) time.Time {
+	t.Helper()
+	result, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestGetOpeningStatus(t *testing.T) {
+	overnight := berlinPlace(period(time.Friday, "1800", time.Saturday, "0200"))
+	alwaysOpen := berlinPlace(maps.OpeningHoursPeriod{Open: maps.OpeningHoursOpenClose{Day: time.Sunday, Time: "0000"}})
+	untilMidnight := berlinPlace(period(time.Monday, "0900", time.Monday, "2400"))
+	// the night clocks go forward in 2021, Sunday 02:00 CET is 03:00 CEST
+	acrossDst := berlinPlace(period(time.Saturday, "2200", time.Sunday, "0400"))
+	daily := berlinPlace(
+		period(time.Monday, "0900", time.Monday, "1700"),
+		period(time.Sunday, "0900", time.Sunday, "1700"),
+	)
+	tests := []struct {
+		name     string
+		place    dao.PlaceDB
+		at       string
+		isKnown  bool
+		isOpen   bool
+		closesAt string
+	}{
+		{"overnight on Friday evening", overnight, "2021-06-04T23:00:00+02:00", true, true, "2021-06-05T02:00:00+02:00"},
+		{"overnight after midnight", overnight, "2021-06-05T01:30:00+02:00", true, true, "2021-06-05T02:00:00+02:00"},
+		{"overnight after close", overnight, "2021-06-05T02:00:00+02:00", true, false, ""},
+		{"overnight before open", overnight, "2021-06-04T17:59:00+02:00", true, false, ""},
+		{"always open", alwaysOpen, "2021-06-04T04:00:00+02:00", true, true, ""},
+		{"close at 2400", untilMidnight, "2021-06-07T23:30:00+02:00", true, true, "2021-06-08T00:00:00+02:00"},
+		{"close at 2400 reached", untilMidnight, "2021-06-08T00:00:00+02:00", true, false, ""},
+		{"close after clocks go forward", acrossDst, "2021-03-27T23:00:00+01:00", true, true, "2021-03-28T04:00:00+02:00"},
+		{"open after clocks go forward", acrossDst, "2021-03-28T03:30:00+02:00", true, true, "2021-03-28T04:00:00+02:00"},
+		{"open in winter time", daily, "2021-03-22T08:30:00Z", true, true, "2021-03-22T17:00:00+01:00"},
+		{"closed in winter time", daily, "2021-03-22T07:30:00Z", true, false, ""},
+		{"open in summer time", daily, "2021-03-29T07:30:00Z", true, true, "2021-03-29T17:00:00+02:00"},
+		{"closed in summer time", daily, "2021-03-29T15:30:00Z", true, false, ""},
+		{"open on day clocks go back", daily, "2021-10-31T15:30:00Z", true, true, "2021-10-31T17:00:00+01:00"},
+		{"no periods", berlinPlace(), "2021-06-04T12:00:00+02:00", false, false, ""},
+		{"invalid time", berlinPlace(period(time.Monday, "0900", time.Monday, "2430")), "2021-06-07T12:00:00+02:00", false, false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := getOpeningStatus(test.place, mustParse(t, test.at))
+			if status.IsKnown != test.isKnown || status.IsOpen != test.isOpen {
+				t.Fatalf("got known %t open %t, want known %t open %t", status.IsKnown, status.IsOpen, test.isKnown, test.isOpen)
+			}
+			if test.closesAt == "" {
+				if status.ClosesAt != nil {
+					t.Fatalf("got closes at %s, want none", status.ClosesAt)
+				}
+				return
+			}
+			if status.ClosesAt == nil || !status.ClosesAt.Equal(mustParse(t, test.closesAt)) {
+				t.Fatalf("got closes at %v, want %s", status.ClosesAt, test.closesAt)
+			}
+		})
+	}
+}
+
+func TestGetOpeningStatusWithoutOpeningHours(t *testing.T) {
+	place := berlinPlace()
+	place.OpeningHours = nil
+	if status := getOpeningStatus(place, time.Now()); status.IsKnown {
+		t.Fatalf("got known status %+v for place without opening hours", status)
+	}
+}
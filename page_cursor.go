@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+// provider page tokens may expire before the cursor, then the search continues in db
+const pageCursorLifetime = time.Hour
+
+const (
+	// pageSourceProvider next page is requested from place provider with its page token
+	pageSourceProvider = "provider"
+	// pageSourceDb next page is searched in db from offset
+	pageSourceDb = "db"
+)
+
+var ErrInvalidPageCursor = errors.New("invalid page cursor")
+var ErrPageCursorExpired = errors.New("page cursor expired")
+
+// Cursors signs page cursors of searches and decks
+var Cursors *PageCursors
+
+// searchPosition where the next page of a search starts, zero value is the first page
+type searchPosition struct {
+	Source        string `json:"src,omitempty"`
+	ProviderToken string `json:"pt,omitempty"`
+	// Offset results of the search before the page
+	Offset uint `json:"o,omitempty"`
+	// Returned places of the provider search before the page, when provider can't continue db search starts
+	// from the beginning without them. Db pages keep excluding them, so their offsets stay the same
+	Returned []uint `json:"ret,omitempty"`
+}
+
+// pageCursor search params and position of the next page, it's returned to clients signed,
+// so next pages don't depend on request params or server state
+type pageCursor struct {
+	Lat      float64        `json:"lat"`
+	Lng      float64        `json:"lng"`
+	Radius   uint           `json:"r"`
+	Type     string         `json:"t,omitempty"`
+	Keyword  string         `json:"k,omitempty"`
+	OpenNow  bool           `json:"on,omitempty"`
+	MinPrice int            `json:"minp"`
+	MaxPrice int            `json:"maxp"`
+	OpenAt   int64          `json:"oa,omitempty"`
+	Position searchPosition `json:"pos"`
+	// Shown places of the page already returned in a deck, by id because the page can come from
+	// another source or in another order when it's requested again
+	Shown     []uint `json:"sh,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func newPageCursor(coordinates maps.LatLng, radius uint, filter dao.SearchFilter, position searchPosition) pageCursor {
+	cursor := pageCursor{
+		Lat:      coordinates.Lat,
+		Lng:      coordinates.Lng,
+		Radius:   radius,
+		Type:     string(filter.Type),
+		Keyword:  filter.Keyword,
+		OpenNow:  filter.OpenNow,
+		MinPrice: filter.MinPrice,
+		MaxPrice: filter.MaxPrice,
+		Position: position,
+	}
+	if !filter.OpenAt.IsZero() {
+		cursor.OpenAt = filter.OpenAt.Unix()
+	}
+	return cursor
+}
+
+// searchParams coordinates, radius and filter of the search the cursor continues
+func (c pageCursor) searchParams() (maps.LatLng, uint, dao.SearchFilter) {
+	filter := dao.SearchFilter{
+		Type:     maps.PlaceType(c.Type),
+		Keyword:  c.Keyword,
+		OpenNow:  c.OpenNow,
+		MinPrice: c.MinPrice,
+		MaxPrice: c.MaxPrice,
+	}
+	if c.OpenAt != 0 {
+		filter.OpenAt = time.Unix(c.OpenAt, 0).UTC()
+	}
+	return maps.LatLng{Lat: c.Lat, Lng: c.Lng}, c.Radius, filter
+}
+
+// isSameSearch check if the cursor continues search with given params
+func (c pageCursor) isSameSearch(coordinates maps.LatLng, radius uint, filter dao.SearchFilter) bool {
+	search := newPageCursor(coordinates, radius, filter, searchPosition{})
+	search.Shown = c.Shown
+	search.ExpiresAt = c.ExpiresAt
+	c.Position = searchPosition{}
+	return reflect.DeepEqual(search, c)
+}
+
+// PageCursors encodes page cursors as base64 JSON with HMAC-SHA256 signature
+type PageCursors struct {
+	Secret []byte
+}
+
+// NewPageCursors cursors signed with secret, it's shared by all API instances so cursors work on any of them
+func NewPageCursors(secret string) (*PageCursors, error) {
+	if secret == "" {
+		return nil, errors.New("page cursor secret is empty")
+	}
+	return &PageCursors{Secret: []byte(secret)}, nil
+}
+
+// Encode sign cursor valid for pageCursorLifetime
+func (p *PageCursors) Encode(cursor pageCursor) string {
+	cursor.ExpiresAt = time.Now().Add(pageCursorLifetime).Unix()
+	data, _ := json.Marshal(cursor)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(p.sign(payload))
+}
+
+// Decode check signature and expiry of the cursor
+func (p *PageCursors) Decode(value string) (pageCursor, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return pageCursor{}, ErrInvalidPageCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, p.sign(parts[0])) {
+		return pageCursor{}, ErrInvalidPageCursor
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return pageCursor{}, ErrInvalidPageCursor
+	}
+	var cursor pageCursor
+	if json.Unmarshal(data, &cursor) != nil {
+		return pageCursor{}, ErrInvalidPageCursor
+	}
+	if time.Unix(cursor.ExpiresAt, 0).Before(time.Now()) {
+		return pageCursor{}, ErrPageCursorExpired
+	}
+	return cursor, nil
+}
+
+func (p *PageCursors) sign(data string) []byte {
+	mac := hmac.New(sha256.New, p.Secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// encodeNextPage cursor of the next page, empty when there are no more pages
+func encodeNextPage(coordinates maps.LatLng, radius uint, filter dao.SearchFilter, next *searchPosition) string {
+	if next == nil {
+		return ""
+	}
+	return Cursors.Encode(newPageCursor(coordinates, radius, filter, *next))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+func testPageCursors(t *testing.T) *PageCursors {
+	t.Helper()
+	cursors, err := NewPageCursors("test secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cursors
+}
+
+func testPageCursor() pageCursor {
+	filter := dao.DefaultSearchFilter()
+	filter.Keyword = "pizza"
+	return newPageCursor(maps.LatLng{Lat: 52.52, Lng: 13.405}, 1500, filter, searchPosition{
+		Source:        pageSourceProvider,
+		ProviderToken: "token",
+		Offset:        20,
+		Returned:      []uint{1, 2, 3},
+	})
+}
+
+// signedCursor sign cursor as is, without setting its expiry
+func signedCursor(cursors *PageCursors, cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(cursors.sign(payload))
+}
+
+func TestNewPageCursorsRequiresSecret(t *testing.T) {
+	if _, err := NewPageCursors(""); err == nil {
+		t.Fatal("cursors without secret are created")
+	}
+}
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	cursors := testPageCursors(t)
+	cursor := testPageCursor()
+	cursor.Shown = []uint{2, 3}
+	decoded, err := cursors.Decode(cursors.Encode(cursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ExpiresAt <= time.Now().Unix() {
+		t.Fatalf("decoded cursor expires at %d", decoded.ExpiresAt)
+	}
+	coordinates, radius, filter := decoded.searchParams()
+	if !decoded.isSameSearch(coordinates, radius, filter) || !cursor.isSameSearch(coordinates, radius, filter) {
+		t.Fatalf("decoded cursor %+v doesn't continue search of %+v", decoded, cursor)
+	}
+	if decoded.Position.ProviderToken != "token" || decoded.Position.Offset != 20 || len(decoded.Position.Returned) != 3 {
+		t.Fatalf("got position %+v", decoded.Position)
+	}
+	if len(decoded.Shown) != 2 || decoded.Shown[0] != 2 || decoded.Shown[1] != 3 {
+		t.Fatalf("got shown places %v, want [2 3]", decoded.Shown)
+	}
+}
+
+func TestPageCursorTampered(t *testing.T) {
+	cursors := testPageCursors(t)
+	encoded := cursors.Encode(testPageCursor())
+	parts := strings.Split(encoded, ".")
+	otherCursor := testPageCursor()
+	otherCursor.Radius = 50000
+	otherData, _ := json.Marshal(otherCursor)
+	otherSecret, _ := NewPageCursors("other secret")
+	tests := map[string]string{
+		"payload":        base64.RawURLEncoding.EncodeToString(otherData) + "." + parts[1],
+		"signature":      parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte("signature")),
+		"no signature":   parts[0],
+		"other secret":   otherSecret.Encode(testPageCursor()),
+		"not base64":     "!." + parts[1],
+		"extra part":     encoded + ".x",
+		"empty":          "",
+		"signed garbage": signedGarbage(cursors),
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := cursors.Decode(value); err != ErrInvalidPageCursor {
+				t.Fatalf("got %v, want %v", err, ErrInvalidPageCursor)
+			}
+		})
+	}
+}
+
+func signedGarbage(cursors *PageCursors) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte("not json"))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(cursors.sign(payload))
+}
+
+func TestPageCursorExpired(t *testing.T) {
+	cursors := testPageCursors(t)
+	cursor := testPageCursor()
+	cursor.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	if _, err := cursors.Decode(signedCursor(cursors, cursor)); err != ErrPageCursorExpired {
+		t.Fatalf("got %v, want %v", err, ErrPageCursorExpired)
+	}
+}
+
+func TestPageCursorIsSameSearch(t *testing.T) {
+	cursor := testPageCursor()
+	coordinates, radius, filter := cursor.searchParams()
+	if !cursor.isSameSearch(coordinates, radius, filter) {
+		t.Fatal("cursor doesn't continue its own search")
+	}
+	otherType := filter
+	otherType.Type = maps.PlaceTypeCafe
+	otherKeyword := filter
+	otherKeyword.Keyword = "sushi"
+	openNow := filter
+	openNow.OpenNow = true
+	openAt := filter
+	openAt.OpenAt = time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		coordinates maps.LatLng
+		radius      uint
+		filter      dao.SearchFilter
+	}{
+		{"coordinates", maps.LatLng{Lat: 48.137, Lng: 11.575}, radius, filter},
+		{"radius", coordinates, radius + 1, filter},
+		{"type", coordinates, radius, otherType},
+		{"keyword", coordinates, radius, otherKeyword},
+		{"open now", coordinates, radius, openNow},
+		{"open at", coordinates, radius, openAt},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if cursor.isSameSearch(test.coordinates, test.radius, test.filter) {
+				t.Fatal("cursor continues search with other params")
+			}
+		})
+	}
+}
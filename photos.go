@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+const MaxPhotoWidth = 600
+const MaxPhotoHeight = 800
+
+// photos waiting for upload, new ones are dropped when queue is full
+const photoQueueSize = 1000
+
+// photoUpload main photo of a saved place or a photo of its gallery to upload
+type photoUpload struct {
+	placeId uint
+	// galleryPhotoId id of the gallery photo, 0 for the main photo
+	galleryPhotoId uint
+	photoName      string
+	photoReference string
+}
+
+var photoUploads chan photoUpload
+
+// names of photos waiting in the queue or being uploaded, so a photo is queued once
+var pendingPhotoUploads sync.Map
+
+// StartPhotoUploaders start workers uploading place photos in background
+func StartPhotoUploaders(workers int) {
+	photoUploads = make(chan photoUpload, photoQueueSize)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for upload := range photoUploads {
+				uploadPhoto(upload)
+			}
+		}()
+	}
+}
+
+// enqueuePhotoUpload upload main photo of the place in background and set its photo url after that
+func enqueuePhotoUpload(place dao.PlaceDB, photoReference string) {
+	if photoReference == "" {
+		return
+	}
+	queuePhotoUpload(photoUpload{placeId: place.Id, photoName: place.GooglePlaceId, photoReference: photoReference})
+}
+
+// enqueueGalleryPhotoUpload upload gallery photo in background and set its urls after that
+func enqueueGalleryPhotoUpload(place dao.PlaceDB, photo dao.PlacePhotoDB) {
+	queuePhotoUpload(photoUpload{
+		placeId:        place.Id,
+		galleryPhotoId: photo.Id,
+		photoName:      galleryPhotoName(place, photo.Position),
+		photoReference: photo.PhotoReference,
+	})
+}
+
+func queuePhotoUpload(upload photoUpload) {
+	if photoUploads == nil {
+		return
+	}
+	if _, isPending := pendingPhotoUploads.LoadOrStore(upload.photoName, true); isPending {
+		return
+	}
+	select {
+	case photoUploads <- upload:
+	default:
+		pendingPhotoUploads.Delete(upload.photoName)
+		log.WithField("placeId", upload.placeId).Warn("Photo upload queue is full, skipping photo")
+	}
+}
+
+func uploadPhoto(upload photoUpload) {
+	defer pendingPhotoUploads.Delete(upload.photoName)
+	photo, err := processAndUploadPhoto(upload)
+	if err != nil {
+		return
+	}
+	if upload.galleryPhotoId != 0 {
+		Dao.PlacePhotosDB.UpdatePlacePhoto(upload.galleryPhotoId, photo)
+		return
+	}
+	Dao.PlacesDB.UpdatePhoto(upload.placeId, photo)
+}
+
+// processAndUploadPhoto get photo from provider and upload its variants to photo storage
+func processAndUploadPhoto(upload photoUpload) (dao.PlacePhoto, error) {
+	photo, err := Dao.MapsApi.GetPhoto(upload.photoReference, MaxPhotoWidth, MaxPhotoHeight)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"placeId": upload.placeId,
+			"error":   err,
+		}).Error("Error getting place photo")
+		return dao.PlacePhoto{}, err
+	}
+	processed, err := processPhoto(photo.Data)
+	photo.Data.Close()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"placeId": upload.placeId,
+			"error":   err,
+		}).Error("Error processing place photo")
+		return dao.PlacePhoto{}, err
+	}
+	result := dao.PlacePhoto{
+		Blurhash: processed.blurhash,
+		Color:    processed.color,
+	}
+	uploads := []struct {
+		variant photoVariant
+		format  photoFormat
+		data    []byte
+		url     *string
+	}{
+		{cardPhotoVariant, jpegPhotoFormat, processed.card.jpeg, &result.Url},
+		{cardPhotoVariant, webpPhotoFormat, processed.card.webp, &result.WebpUrl},
+		{thumbnailPhotoVariant, jpegPhotoFormat, processed.thumbnail.jpeg, &result.ThumbUrl},
+		{thumbnailPhotoVariant, webpPhotoFormat, processed.thumbnail.webp, &result.ThumbWebpUrl},
+	}
+	for _, u := range uploads {
+		*u.url, err = uploadPhotoVariant(upload, u.variant, u.format, u.data)
+		if err != nil {
+			return dao.PlacePhoto{}, err
+		}
+	}
+	return result, nil
+}
+
+func uploadPhotoVariant(upload photoUpload, variant photoVariant, format photoFormat, data []byte) (string, error) {
+	name := upload.photoName + variant.suffix + format.extension
+	photoUrl, err := Dao.PhotoStorage.UploadPhoto(name, ioutil.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"placeId": upload.placeId,
+			"name":    name,
+			"error":   err,
+		}).Error("Error uploading place photo")
+	}
+	return photoUrl, err
+}
+
+func getMainPhotoReference(photos []maps.Photo) string {
+	if len(photos) == 0 {
+		return ""
+	}
+	return photos[0].PhotoReference
+}
+
+// GetPlacePhotos get gallery of the place, photo references are requested from provider when the gallery is opened
+// for the first time. Images that are not uploaded yet are queued for upload and skipped, they are returned once uploaded
+func GetPlacePhotos(place dao.PlaceDB) ([]PlacePhotoResponse, error) {
+	photos, isFetched, err := Dao.PlacePhotosDB.GetPlacePhotos(place.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !isFetched {
+		details, err := Dao.MapsApi.GetPlaceInfoFromMaps(place.ProviderPlaceId(), []maps.PlaceDetailsFieldMask{maps.PlaceDetailsFieldMaskPhotos})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"placeId": place.Id,
+				"error":   err,
+			}).Error("Error getting place photo references")
+			return nil, err
+		}
+		err = Dao.PlacePhotosDB.SavePhotoReferences(place.Id, details.Photos)
+		if err != nil {
+			return nil, err
+		}
+		photos, _, err = Dao.PlacePhotosDB.GetPlacePhotos(place.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range photos {
+		photo := &photos[i]
+		if photo.PhotoUrl.Valid {
+			continue
+		}
+		// main photo is uploaded with the place
+		if photo.Position == 0 && place.PhotoWebpUrl.Valid {
+			setPlacePhoto(photo, dao.PlacePhoto{
+				Url:          place.PhotoUrl.String,
+				ThumbUrl:     place.PhotoThumbUrl.String,
+				WebpUrl:      place.PhotoWebpUrl.String,
+				ThumbWebpUrl: place.PhotoThumbWebpUrl.String,
+				Blurhash:     place.PhotoBlurhash.String,
+				Color:        place.PhotoColor.String,
+			})
+			continue
+		}
+		enqueueGalleryPhotoUpload(place, *photo)
+	}
+
+	result := []PlacePhotoResponse{}
+	for _, photo := range photos {
+		if !photo.PhotoUrl.Valid {
+			continue
+		}
+		result = append(result, PlacePhotoResponse{
+			Url:          photo.PhotoUrl.String,
+			ThumbUrl:     nullStringToPtr(photo.PhotoThumbUrl),
+			WebpUrl:      nullStringToPtr(photo.PhotoWebpUrl),
+			ThumbWebpUrl: nullStringToPtr(photo.PhotoThumbWebpUrl),
+			Blurhash:     nullStringToPtr(photo.PhotoBlurhash),
+			Color:        nullStringToPtr(photo.PhotoColor),
+			Width:        photo.Width,
+			Height:       photo.Height,
+			Attributions: photo.Attributions,
+		})
+	}
+	return result, nil
+}
+
+// setPlacePhoto save uploaded image of the gallery photo
+func setPlacePhoto(photo *dao.PlacePhotoDB, uploaded dao.PlacePhoto) {
+	if Dao.PlacePhotosDB.UpdatePlacePhoto(photo.Id, uploaded) != nil {
+		return
+	}
+	photo.PhotoUrl = sql.NullString{String: uploaded.Url, Valid: true}
+	photo.PhotoThumbUrl = sql.NullString{String: uploaded.ThumbUrl, Valid: true}
+	photo.PhotoWebpUrl = sql.NullString{String: uploaded.WebpUrl, Valid: true}
+	photo.PhotoThumbWebpUrl = sql.NullString{String: uploaded.ThumbWebpUrl, Valid: true}
+	photo.PhotoBlurhash = sql.NullString{String: uploaded.Blurhash, Valid: true}
+	photo.PhotoColor = sql.NullString{String: uploaded.Color, Valid: true}
+}
+
+// galleryPhotoName name of the photo in storage, the first one is the main photo of the place
+func galleryPhotoName(place dao.PlaceDB, position int) string {
+	if position == 0 {
+		return place.GooglePlaceId
+	}
+	return fmt.Sprintf("%s-%d", place.GooglePlaceId, position)
+}
+
+// localPhotoHandler serve photos of local photo storage
+func localPhotoHandler(storage *dao.LocalPhotoStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=604800")
+		http.ServeFile(w, r, storage.PhotoPath(mux.Vars(r)["id"]))
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+// FindPlaceByGoogleId get place by google place id, details are requested from provider when place is not saved yet.
+// Nil if provider doesn't know the place either
+func FindPlaceByGoogleId(googlePlaceId string) (*dao.PlaceDB, error) {
+	place, err := Dao.PlacesDB.GetPlaceByPlaceId(googlePlaceId)
+	if err != nil || place != nil {
+		return place, err
+	}
+	log.WithField("googlePlaceId", googlePlaceId).Info("Place is not cached, getting details")
+	places, err := getPlaces([]string{googlePlaceId})
+	if err != nil || len(places) == 0 {
+		return nil, err
+	}
+	return &places[0], nil
+}
+
+// GetPlaceDetail full place record with like of the device and like counts of all users,
+// distance is calculated only when coordinates are given
+func GetPlaceDetail(place dao.PlaceDB, deviceId string, coordinates *maps.LatLng) (PlaceDetailResponse, error) {
+	placesDb := []dao.PlaceDB{place}
+	likes, err := getLikes(deviceId, placesDb)
+	if err != nil {
+		return PlaceDetailResponse{}, err
+	}
+	likeCounts, err := Dao.LikesDB.GetLikeCounts([]uint{place.Id})
+	if err != nil {
+		return PlaceDetailResponse{}, err
+	}
+	var distance *uint
+	var origin maps.LatLng
+	if coordinates != nil {
+		origin = *coordinates
+	}
+	response := placeDBtoResponse(placesDb, likes, origin)[0]
+	if coordinates != nil {
+		distance = &response.Distance
+	}
+	return PlaceDetailResponse{
+		PlaceResponse: response,
+		Distance:      distance,
+		LikeCount:     likeCounts[place.Id].Likes,
+		DislikeCount:  likeCounts[place.Id].Dislikes,
+	}, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"hungries-api/dao"
+)
+
+// number of places refreshed in one run
+const placeRefreshBatchSize = 100
+
+// places that failed to refresh are tried again after that instead of waiting for max age
+const placeRefreshRetryDelay = 30 * time.Minute
+
+// StartPlaceRefreshJob every interval re-fetch details of places not updated for maxAge
+func StartPlaceRefreshJob(interval time.Duration, maxAge time.Duration) {
+	go func() {
+		for {
+			refreshStalePlaces(maxAge)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func refreshStalePlaces(maxAge time.Duration) {
+	places, err := Dao.PlacesDB.ClaimStalePlaces(maxAge, placeRefreshBatchSize)
+	if err != nil {
+		log.WithField("error", err).Error("Error getting stale places")
+		return
+	}
+	log.WithField("places", len(places)).Info("Refreshing stale places")
+	for i, place := range places {
+		err = refreshPlace(place)
+		if err == ErrMapsBudgetExceeded {
+			// the rest of the batch would fail the same way, it's tried again when budget is refilled
+			log.WithField("places", len(places)-i).Warn("Maps api budget is used up, place refresh is postponed")
+			for _, notRefreshed := range places[i:] {
+				Dao.PlacesDB.RetryPlaceRefresh(notRefreshed.Id, maxAge, placeRefreshRetryDelay)
+			}
+			return
+		}
+		if err != nil {
+			Dao.PlacesDB.RetryPlaceRefresh(place.Id, maxAge, placeRefreshRetryDelay)
+		}
+	}
+}
+
+// refreshPlace update place with current details, mark it as not found if provider doesn't know it anymore.
+// Returns error if the place wasn't refreshed
+func refreshPlace(place dao.PlaceDB) error {
+	details, err := Dao.MapsApi.GetPlaceInfoFromMaps(place.GooglePlaceId, placeDetailsFields)
+	if err != nil && strings.Contains(err.Error(), dao.BusinessStatusNotFound) {
+		log.WithField("placeId", place.Id).Info("Place is not found anymore")
+		err = Dao.PlacesDB.UpdateBusinessStatus(place.Id, dao.BusinessStatusNotFound)
+		if err == nil {
+			notifyPlaceRefreshed(place.Id)
+		}
+		return err
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"placeId": place.Id,
+			"error":   err,
+		}).Error("Error refreshing place")
+		return err
+	}
+
+	updatedPlace := place
+	setPlaceDetails(&updatedPlace, details)
+	err = Dao.PlacesDB.UpdatePlace(updatedPlace)
+	if err != nil {
+		return err
+	}
+	// places with photos uploaded before all variants were introduced get them on refresh
+	if !place.PhotoWebpUrl.Valid {
+		enqueuePhotoUpload(place, getMainPhotoReference(details.Photos))
+	}
+	if isPlaceChanged(place, updatedPlace) {
+		notifyPlaceRefreshed(place.Id)
+	}
+	return nil
+}
+
+func isPlaceChanged(old dao.PlaceDB, new dao.PlaceDB) bool {
+	return old.Name != new.Name ||
+		old.Url != new.Url ||
+		dao.GetDistance(old.Lat, old.Lng, new.Lat, new.Lng) > 1 ||
+		old.BusinessStatus != new.BusinessStatus ||
+		old.PriceLevel != new.PriceLevel
+}
+
+// notifyPlaceRefreshed send place_refreshed event to devices which liked the place
+func notifyPlaceRefreshed(placeId uint) {
+	deviceIds, err := Dao.LikesDB.GetUsersWhoLiked(placeId)
+	if err != nil {
+		return
+	}
+	Events.Publish(Event{
+		Type:    EventPlaceRefreshed,
+		PlaceId: placeId,
+	}, deviceIds)
+}
@@ -3,62 +3,188 @@ package main
 import (
 	"database/sql"
 	log "github.com/sirupsen/logrus"
+	"github.com/zsefvlol/timezonemapper"
 	"googlemaps.github.io/maps"
 	"hungries-api/dao"
 	"math"
+	"sort"
+	"time"
 )
 
-const MaxPhotoWidth = 600
-const MaxPhotoHeight = 800
+// page size of nearby search served from db, same as in Maps API
+const cachePageSize = 20
 
-func FindNearbyPlaces(coordinates maps.LatLng, radius uint, pageToken string, deviceId string) (PlacesResponse, error) {
+// Maps API returns at most that many results of one nearby search, dense areas have more places
+const maxProviderSearchResults = 60
+
+// fields of place details stored in db
+var placeDetailsFields = []maps.PlaceDetailsFieldMask{
+	maps.PlaceDetailsFieldMaskURL,
+	maps.PlaceDetailsFieldMaskName,
+	maps.PlaceDetailsFieldMaskGeometryLocationLat,
+	maps.PlaceDetailsFieldMaskGeometryLocationLng,
+	maps.PlaceDetailsFieldMaskPhotos,
+	maps.PlaceDetailsFieldMaskTypes,
+	maps.PlaceDetailsFieldMaskPriceLevel,
+	maps.PlaceDetailsFieldMaskBusinessStatus,
+	maps.PlaceDetailsFieldMaskRatings,
+	maps.PlaceDetailsFieldMaskUserRatingsTotal,
+	maps.PlaceDetailsFieldMaskFormattedAddress,
+	maps.PlaceDetailsFieldMaskInternationalPhoneNumber,
+	maps.PlaceDetailsFieldMaskWebsite,
+	maps.PlaceDetailsFieldMaskOpeningHours,
+	maps.PlaceDetailsFieldMaskUTCOffset,
+}
+
+// SearchCacheMaxAge how long searched area is served from db without Maps API requests
+var SearchCacheMaxAge = 72 * time.Hour
+
+// IsSearchAreaSaved save areas searched with the provider, so they are served from db. Only Google searches cover
+// an area, fixture and OSM places in db would hide Google places after switching back to it
+var IsSearchAreaSaved = true
+
+func FindNearbyPlaces(coordinates maps.LatLng, radius uint, filter dao.SearchFilter, position searchPosition, deviceId string, sortBy string) (PlacesResponse, error) {
 	log.WithFields(log.Fields{
 		"coordinates": coordinates,
 		"radius":      radius,
-		"pageToken":   pageToken,
+		"filter":      filter,
+		"position":    position,
 		"deviceId":    deviceId,
+		"sort":        sortBy,
 	}).Info("Searching places neardby")
-	nearbySearchResp, err := Dao.MapsApi.FindNearbyPlaces(coordinates, radius, pageToken)
+	placesDb, next, err := searchPlacesPage(coordinates, radius, filter, position)
+	if err != nil {
+		return PlacesResponse{}, err
+	}
+	placesDb = filterByOpeningHours(placesDb, filter)
+
+	likes, err := getLikes(deviceId, placesDb)
+	if err != nil {
+		return PlacesResponse{}, err
+	}
+
+	placesDb, scores, err := rankPlaces(placesDb, deviceId, coordinates, sortBy)
 	if err != nil {
-		log.WithField("error", err).Error("Error finding places via Maps API")
 		return PlacesResponse{}, err
 	}
+	places := placeDBtoResponse(placesDb, likes, coordinates)
+	for i := range places {
+		score := scores[places[i].Id]
+		places[i].Score = &score
+	}
+
+	response := PlacesResponse{
+		Places:        places,
+		NextPageToken: encodeNextPage(coordinates, radius, filter, next),
+	}
+	return response, nil
+}
+
+// searchPlacesPage get one page of nearby places and position of the next one, nil when it's the last page.
+// The first page is served from db if the area was searched recently or from place provider otherwise,
+// next pages continue from the same source. Opening hours filters are not applied, see filterByOpeningHours
+func searchPlacesPage(coordinates maps.LatLng, radius uint, filter dao.SearchFilter, position searchPosition) ([]dao.PlaceDB, *searchPosition, error) {
+	if position.Source == pageSourceDb {
+		return findCachedNearbyPlaces(coordinates, radius, filter, position.Offset, position.Returned)
+	}
+	if position.ProviderToken == "" {
+		isSearched, err := Dao.SearchAreasDB.IsAreaSearched(coordinates.Lat, coordinates.Lng, radius, filter.Type, SearchCacheMaxAge)
+		if err == nil && isSearched {
+			return findCachedNearbyPlaces(coordinates, radius, filter, 0, nil)
+		}
+	}
+
+	nearbySearchResp, err := Dao.MapsApi.FindNearbyPlaces(coordinates, radius, position.ProviderToken, filter)
+	if err == ErrMapsBudgetExceeded || (err != nil && position.ProviderToken != "") {
+		// serve what is in db, provider and db order places differently, so db search starts from the beginning
+		// without places provider pages returned already
+		log.WithField("error", err).Warn("Nearby search continues in db")
+		return findCachedNearbyPlaces(coordinates, radius, filter, 0, position.Returned)
+	}
+	if err != nil {
+		log.WithField("error", err).Error("Error finding places via Maps API")
+		return nil, nil, err
+	}
 
 	var placesGoogleIds = make([]string, len(nearbySearchResp.Results))
 	for i, googleId := range nearbySearchResp.Results {
 		placesGoogleIds[i] = googleId.PlaceID
 	}
 
-	// get places and likes info from db
+	// get places info from db
 	placesDb, _ := getPlaces(placesGoogleIds)
+	placesDb = excludeGonePlaces(placesDb)
 
-	var internalPlacesIds []uint
+	// last page of unfiltered results, all places of that type in the area are in db now
+	// unless provider cut the search at its limit, then the area is searched again next time
+	searchedResults := position.Offset + uint(len(nearbySearchResp.Results))
+	if IsSearchAreaSaved && nearbySearchResp.NextPageToken == "" && !filter.IsNarrowed() {
+		if searchedResults < maxProviderSearchResults {
+			Dao.SearchAreasDB.SaveSearchArea(coordinates.Lat, coordinates.Lng, radius, filter.Type)
+		} else {
+			log.WithFields(log.Fields{
+				"coordinates": coordinates,
+				"radius":      radius,
+				"results":     searchedResults,
+			}).Info("Search area is not saved, provider results are truncated")
+		}
+	}
+	if nearbySearchResp.NextPageToken == "" {
+		return placesDb, nil, nil
+	}
+	returned := append([]uint{}, position.Returned...)
 	for _, p := range placesDb {
-		internalPlacesIds = append(internalPlacesIds, p.Id)
+		returned = append(returned, p.Id)
+	}
+	return placesDb, &searchPosition{
+		Source:        pageSourceProvider,
+		ProviderToken: nearbySearchResp.NextPageToken,
+		Offset:        position.Offset + uint(len(nearbySearchResp.Results)),
+		Returned:      returned,
+	}, nil
+}
+
+// findCachedNearbyPlaces search places in db instead of Maps API, places returned by provider pages are excluded
+func findCachedNearbyPlaces(coordinates maps.LatLng, radius uint, filter dao.SearchFilter, offset uint, returned []uint) ([]dao.PlaceDB, *searchPosition, error) {
+	log.WithFields(log.Fields{
+		"coordinates": coordinates,
+		"radius":      radius,
+		"filter":      filter,
+		"offset":      offset,
+		"returned":    len(returned),
+	}).Info("Searching places nearby in db")
+	placesDb, err := Dao.PlacesDB.FindPlacesNearby(coordinates.Lat, coordinates.Lng, radius, filter, cachePageSize+1, offset, returned)
+	if err != nil {
+		return nil, nil, err
 	}
-	var likes map[uint]bool
-	if deviceId != "" {
-		likes, err = Dao.LikesDB.GetLikesForDevice(deviceId, internalPlacesIds)
-	} else {
-		likes = map[uint]bool{}
+	if len(placesDb) <= cachePageSize {
+		return placesDb, nil, nil
 	}
+	return placesDb[:cachePageSize], &searchPosition{Source: pageSourceDb, Offset: offset + cachePageSize, Returned: returned}, nil
+}
 
-	response := PlacesResponse{
-		Places:        placeDBtoResponse(placesDb, likes, coordinates),
-		NextPageToken: nearbySearchResp.NextPageToken,
+func getLikes(deviceId string, placesDb []dao.PlaceDB) (map[uint]bool, error) {
+	if deviceId == "" {
+		return map[uint]bool{}, nil
 	}
-	return response, nil
+	var internalPlacesIds []uint
+	for _, p := range placesDb {
+		internalPlacesIds = append(internalPlacesIds, p.Id)
+	}
+	return Dao.LikesDB.GetLikesForDevice(deviceId, internalPlacesIds)
 }
 
-func FindLikedPlaces(deviceId string, coordinates maps.LatLng) (PlacesResponse, error) {
+func FindLikedPlaces(deviceId string, coordinates maps.LatLng, openAt time.Time) (PlacesResponse, error) {
 	log.WithFields(log.Fields{
 		"deviceId":    deviceId,
 		"coordinates": coordinates,
+		"openAt":      openAt,
 	}).Info("Getting liked places")
 	placesDb, err := Dao.PlacesDB.GetLikedPlacesForDevice(deviceId)
 	if err != nil {
 		return PlacesResponse{}, err
 	}
+	placesDb = filterByOpeningHours(placesDb, dao.SearchFilter{OpenAt: openAt})
 	likes := make(map[uint]bool)
 	for _, p := range placesDb {
 		likes[p.Id] = true
@@ -71,34 +197,105 @@ func FindLikedPlaces(deviceId string, coordinates maps.LatLng) (PlacesResponse,
 
 func placeDBtoResponse(placesDb []dao.PlaceDB, likes map[uint]bool, coordinates maps.LatLng) []PlaceResponse {
 	var result []PlaceResponse
+	now := time.Now()
 	for _, placeDb := range placesDb {
+		var isOpenNow *bool
+		openingStatus := getOpeningStatus(placeDb, now)
+		if openingStatus.IsKnown {
+			isOpenNow = &openingStatus.IsOpen
+		}
 		var isLiked *bool
 		if isLikedVal, ok := likes[placeDb.Id]; ok {
 			isLiked = &isLikedVal
 		}
-		var photoUrl *string
-		if placeDb.PhotoUrl.Valid {
-			var photoUrlCopy = placeDb.PhotoUrl.String
-			photoUrl = &photoUrlCopy
-		}
 		placeResponse := PlaceResponse{
 			Id:            placeDb.Id,
 			GooglePlaceId: placeDb.GooglePlaceId,
+			OsmId:         nullStringToPtr(placeDb.OsmId),
 			Name:          placeDb.Name,
 			Url:           placeDb.Url,
 			Location: LocationResponse{
 				Latitude:  placeDb.Lat,
 				Longitude: placeDb.Lng,
 			},
-			Distance: uint(getDistance(coordinates.Lat, coordinates.Lng, placeDb.Lat, placeDb.Lng)),
-			PhotoUrl: photoUrl,
-			IsLiked:  isLiked,
+			Distance:          uint(dao.GetDistance(coordinates.Lat, coordinates.Lng, placeDb.Lat, placeDb.Lng)),
+			PhotoUrl:          nullStringToPtr(placeDb.PhotoUrl),
+			PhotoThumbUrl:     nullStringToPtr(placeDb.PhotoThumbUrl),
+			PhotoWebpUrl:      nullStringToPtr(placeDb.PhotoWebpUrl),
+			PhotoThumbWebpUrl: nullStringToPtr(placeDb.PhotoThumbWebpUrl),
+			PhotoBlurhash:     nullStringToPtr(placeDb.PhotoBlurhash),
+			PhotoColor:        nullStringToPtr(placeDb.PhotoColor),
+			IsLiked:           isLiked,
+			BusinessStatus:    placeDb.BusinessStatus,
+			Types:             placeDb.Types,
+			PriceLevel:        nullInt32ToPtr(placeDb.PriceLevel),
+			Rating:            nullFloat64ToPtr(placeDb.Rating),
+			UserRatingsTotal:  nullInt32ToPtr(placeDb.UserRatingsTotal),
+			Address:           nullStringToPtr(placeDb.FormattedAddress),
+			Phone:             nullStringToPtr(placeDb.Phone),
+			Website:           nullStringToPtr(placeDb.Website),
+			OpeningHours:      openingHoursToResponse(placeDb.OpeningHours),
+			IsOpenNow:         isOpenNow,
+			ClosesAt:          openingStatus.ClosesAt,
 		}
 		result = append(result, placeResponse)
 	}
 	return result
 }
 
+func openingHoursToResponse(openingHours *maps.OpeningHours) *OpeningHoursResponse {
+	if openingHours == nil {
+		return nil
+	}
+	var periods []OpeningPeriodResponse
+	for _, p := range openingHours.Periods {
+		period := OpeningPeriodResponse{
+			Open: OpeningTimeResponse{Day: int(p.Open.Day), Time: p.Open.Time},
+		}
+		// places open 24/7 have a single period without close time
+		if p.Close.Time != "" {
+			period.Close = &OpeningTimeResponse{Day: int(p.Close.Day), Time: p.Close.Time}
+		}
+		periods = append(periods, period)
+	}
+	return &OpeningHoursResponse{
+		Periods:     periods,
+		WeekdayText: openingHours.WeekdayText,
+	}
+}
+
+func nullStringToPtr(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	var valueCopy = value.String
+	return &valueCopy
+}
+
+func nullBoolToPtr(value sql.NullBool) *bool {
+	if !value.Valid {
+		return nil
+	}
+	var valueCopy = value.Bool
+	return &valueCopy
+}
+
+func nullInt32ToPtr(value sql.NullInt32) *int {
+	if !value.Valid {
+		return nil
+	}
+	var valueCopy = int(value.Int32)
+	return &valueCopy
+}
+
+func nullFloat64ToPtr(value sql.NullFloat64) *float64 {
+	if !value.Valid {
+		return nil
+	}
+	var valueCopy = value.Float64
+	return &valueCopy
+}
+
 func getPlaces(googlePlaceIds []string) ([]dao.PlaceDB, error) {
 	// check db
 	var existingPlaces, err = Dao.PlacesDB.GetPlacesByPlaceIdsForDevice(googlePlaceIds)
@@ -109,7 +306,8 @@ func getPlaces(googlePlaceIds []string) ([]dao.PlaceDB, error) {
 		}).Info("Error getting places from db")
 	}
 	if len(existingPlaces) == len(googlePlaceIds) {
-		return existingPlaces, nil
+		MapsUsage.RecordPlaceCache(len(existingPlaces), 0)
+		return sortByProviderOrder(existingPlaces, googlePlaceIds), nil
 	}
 
 	var result []dao.PlaceDB
@@ -124,103 +322,117 @@ func getPlaces(googlePlaceIds []string) ([]dao.PlaceDB, error) {
 			missingPlacesGoogleIds = append(missingPlacesGoogleIds, placeId)
 		}
 	}
+	MapsUsage.RecordPlaceCache(len(existingPlaces), len(missingPlacesGoogleIds))
 
 	// get new places from google maps API
-	newPlacesToSaveChan := make(chan dao.PlaceDB)
+	newPlacesChan := make(chan newPlace)
 	for _, missingPlaceId := range missingPlacesGoogleIds {
-		go getInfoAndUploadPhoto(missingPlaceId, newPlacesToSaveChan)
+		go getPlaceInfo(missingPlaceId, newPlacesChan)
 	}
 
 	var newPlacesToSave []dao.PlaceDB
+	placePhotos := make(map[string][]maps.Photo)
 	for i := 0; i < len(missingPlacesGoogleIds); i++ {
-		place := <-newPlacesToSaveChan
-		newPlacesToSave = append(newPlacesToSave, place)
+		newPlace := <-newPlacesChan
+		if newPlace.err != nil {
+			continue
+		}
+		newPlacesToSave = append(newPlacesToSave, newPlace.place)
+		placePhotos[newPlace.place.GooglePlaceId] = newPlace.photos
+	}
+	if len(newPlacesToSave) == 0 {
+		return sortByProviderOrder(result, googlePlaceIds), nil
 	}
 
-	// save new places
+	// save new places, photos are uploaded after that in background
 	var newSavedPlaces = Dao.PlacesDB.SavePlaces(newPlacesToSave)
 	for _, p := range newSavedPlaces {
 		result = append(result, p)
+		Dao.PlacePhotosDB.SavePhotoReferences(p.Id, placePhotos[p.GooglePlaceId])
+		enqueuePhotoUpload(p, getMainPhotoReference(placePhotos[p.GooglePlaceId]))
 	}
-	return result, nil
+	return sortByProviderOrder(result, googlePlaceIds), nil
 }
 
-func getInfoAndUploadPhoto(googlePlaceID string, newPlacesToSave chan dao.PlaceDB) {
-	var placeDetailsResult, err = Dao.MapsApi.GetPlaceInfoFromMaps(googlePlaceID, []maps.PlaceDetailsFieldMask{
-		maps.PlaceDetailsFieldMaskURL,
-		maps.PlaceDetailsFieldMaskName,
-		maps.PlaceDetailsFieldMaskGeometryLocationLat,
-		maps.PlaceDetailsFieldMaskGeometryLocationLng,
-		maps.PlaceDetailsFieldMaskPhotos,
+// excludeGonePlaces remove places closed for good
+func excludeGonePlaces(places []dao.PlaceDB) []dao.PlaceDB {
+	var result []dao.PlaceDB
+	for _, p := range places {
+		if !p.IsGone() {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// sortByProviderOrder order places the same way as provider returned their ids
+func sortByProviderOrder(places []dao.PlaceDB, providerPlaceIds []string) []dao.PlaceDB {
+	positions := make(map[string]int, len(providerPlaceIds))
+	for i, id := range providerPlaceIds {
+		positions[id] = i
+	}
+	sort.SliceStable(places, func(i, j int) bool {
+		return positions[places[i].ProviderPlaceId()] < positions[places[j].ProviderPlaceId()]
 	})
+	return places
+}
+
+// newPlace details of a place that is not in db yet
+type newPlace struct {
+	place  dao.PlaceDB
+	photos []maps.Photo
+	err    error
+}
+
+func getPlaceInfo(googlePlaceID string, newPlaces chan newPlace) {
+	var placeDetailsResult, err = Dao.MapsApi.GetPlaceInfoFromMaps(googlePlaceID, placeDetailsFields)
 	if err != nil {
 		log.Print(err)
+		newPlaces <- newPlace{err: err}
 		return
 	}
-	// get photo and save it to cloud
-	// disabled
-	// photoUrl, _ := uploadMainPhoto(googlePlaceID, placeDetailsResult.Photos)
 	var newPlaceDb = dao.PlaceDB{
 		GooglePlaceId: googlePlaceID,
-		Name:          placeDetailsResult.Name,
-		Url:           placeDetailsResult.URL,
-		Lat:           placeDetailsResult.Geometry.Location.Lat,
-		Lng:           placeDetailsResult.Geometry.Location.Lng,
-		//PhotoUrl:      sql.NullString{String: photoUrl, Valid: photoUrl != ""},
-		PhotoUrl: sql.NullString{String: "", Valid: true},
 	}
-	newPlacesToSave <- newPlaceDb
+	setPlaceDetails(&newPlaceDb, placeDetailsResult)
+	newPlaces <- newPlace{
+		place:  newPlaceDb,
+		photos: placeDetailsResult.Photos,
+	}
+}
+
+// setPlaceDetails copy details requested with placeDetailsFields to place
+func setPlaceDetails(place *dao.PlaceDB, details maps.PlaceDetailsResult) {
+	place.Name = details.Name
+	place.Url = details.URL
+	place.Lat = details.Geometry.Location.Lat
+	place.Lng = details.Geometry.Location.Lng
+	place.Types = details.Types
+	// 0 is a free place, providers return UnknownPriceLevel when they don't know the price
+	place.PriceLevel = sql.NullInt32{Int32: int32(details.PriceLevel), Valid: details.PriceLevel >= dao.MinPriceLevel}
+	place.BusinessStatus = details.BusinessStatus
+	if place.BusinessStatus == "" {
+		place.BusinessStatus = dao.BusinessStatusOperational
+	}
+	// rating has one decimal digit, round away float32 noise
+	place.Rating = sql.NullFloat64{Float64: math.Round(float64(details.Rating)*10) / 10, Valid: details.UserRatingsTotal > 0}
+	place.UserRatingsTotal = sql.NullInt32{Int32: int32(details.UserRatingsTotal), Valid: details.UserRatingsTotal > 0}
+	place.FormattedAddress = sql.NullString{String: details.FormattedAddress, Valid: details.FormattedAddress != ""}
+	place.Phone = sql.NullString{String: details.InternationalPhoneNumber, Valid: details.InternationalPhoneNumber != ""}
+	place.Website = sql.NullString{String: details.Website, Valid: details.Website != ""}
+	place.OpeningHours = details.OpeningHours
+	if details.UTCOffset != nil {
+		place.UtcOffset = sql.NullInt32{Int32: int32(*details.UTCOffset), Valid: true}
+	}
+	timeZone := timezonemapper.LatLngToTimezoneString(place.Lat, place.Lng)
+	place.TimeZone = sql.NullString{String: timeZone, Valid: timeZone != ""}
 }
 
 func contains(s []dao.PlaceDB, e string) bool {
 	for _, a := range s {
-		if a.GooglePlaceId == e {
+		if a.ProviderPlaceId() == e {
 			return true
 		}
 	}
 	return false
 }
-
-func uploadMainPhoto(placeId string, photos []maps.Photo) (string, error) {
-	if len(photos) == 0 {
-		return "", nil
-	}
-	firstPhoto := photos[0]
-	photoReference := firstPhoto.PhotoReference
-	photo, err := Dao.MapsApi.GetPhoto(photoReference, MaxPhotoWidth, MaxPhotoHeight)
-	if err != nil {
-		log.Print(err)
-		return "", err
-	}
-	photoUrl, err := Dao.CloudStorage.UploadPhoto(placeId, photo.Data)
-	if err != nil {
-		log.Print(err)
-		return "", err
-	}
-	return photoUrl, nil
-}
-
-// Distance between 2 points in meters
-// See https://gist.github.com/cdipaolo/d3f8db3848278b49db68
-// http://en.wikipedia.org/wiki/Haversine_formula
-func getDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	// convert to radians
-	// must cast radius as float to multiply later
-	var la1, lo1, la2, lo2, r float64
-	la1 = lat1 * math.Pi / 180
-	lo1 = lon1 * math.Pi / 180
-	la2 = lat2 * math.Pi / 180
-	lo2 = lon2 * math.Pi / 180
-
-	r = 6378100 // Earth radius in METERS
-
-	// calculate
-	h := hsin(la2-la1) + math.Cos(la1)*math.Cos(la2)*hsin(lo2-lo1)
-
-	return 2 * r * math.Asin(math.Sqrt(h))
-}
-
-// haversin(θ) function
-func hsin(theta float64) float64 {
-	return math.Pow(math.Sin(theta/2), 2)
-}
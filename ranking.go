@@ -0,0 +1,200 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+const SortRelevance = "relevance"
+const SortDistance = "distance"
+const SortPopularity = "popularity"
+
+// number of recent likes and dislikes used to build device preferences
+const rankingHistorySize = 500
+
+// liked places farther than that are likely in another city and don't tell anything about accepted distance
+const maxAcceptedDistance = 10000
+
+// accepted distance when device has no liked places nearby
+const defaultAcceptedDistance = 1000
+
+// weights of relevance score parts
+const preferenceWeight = 0.5
+const popularityWeight = 0.2
+const distanceWeight = 0.3
+
+// types every place has, they don't tell anything about preferences
+var genericPlaceTypes = map[string]bool{
+	"point_of_interest": true,
+	"establishment":     true,
+	"food":              true,
+}
+
+// deviceProfile preferences learned from device likes and dislikes
+type deviceProfile struct {
+	// from -1 for always disliked to 1 for always liked
+	typeAffinity  map[string]float64
+	priceAffinity map[int]float64
+	// typical distance to liked places in meters
+	acceptedDistance float64
+}
+
+type rankedPlace struct {
+	place      dao.PlaceDB
+	score      float64
+	popularity float64
+	distance   float64
+}
+
+// rankPlaces order places by sortBy and calculate relevance score of every place for device
+func rankPlaces(placesDb []dao.PlaceDB, deviceId string, coordinates maps.LatLng, sortBy string) ([]dao.PlaceDB, map[uint]float64, error) {
+	scores := make(map[uint]float64)
+	if len(placesDb) == 0 {
+		return placesDb, scores, nil
+	}
+	profile, err := getDeviceProfile(deviceId)
+	if err != nil {
+		return nil, nil, err
+	}
+	var placeIds []uint
+	for _, p := range placesDb {
+		placeIds = append(placeIds, p.Id)
+	}
+	likeCounts, err := Dao.LikesDB.GetLikeCounts(placeIds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ranked := make([]rankedPlace, len(placesDb))
+	for i, p := range placesDb {
+		distance := dao.GetDistance(coordinates.Lat, coordinates.Lng, p.Lat, p.Lng)
+		ranked[i] = profile.rank(p, distance, likeCounts[p.Id])
+		scores[p.Id] = ranked[i].score
+	}
+	return sortRanked(ranked, sortBy), scores, nil
+}
+
+// rank relevance score of the place distance meters away with likeCount likes of all users
+func (profile deviceProfile) rank(place dao.PlaceDB, distance float64, likeCount dao.LikeCount) rankedPlace {
+	popularity := getPopularity(likeCount)
+	score := preferenceWeight*profile.preference(place) +
+		popularityWeight*popularity +
+		distanceWeight*math.Exp(-distance/profile.acceptedDistance)
+	return rankedPlace{place: place, score: score, popularity: popularity, distance: distance}
+}
+
+// sortRanked order places by sortBy, best score first by default
+func sortRanked(ranked []rankedPlace, sortBy string) []dao.PlaceDB {
+	sort.SliceStable(ranked, func(i, j int) bool {
+		switch sortBy {
+		case SortDistance:
+			return ranked[i].distance < ranked[j].distance
+		case SortPopularity:
+			return ranked[i].popularity > ranked[j].popularity
+		default:
+			return ranked[i].score > ranked[j].score
+		}
+	})
+	result := make([]dao.PlaceDB, len(ranked))
+	for i, r := range ranked {
+		result[i] = r.place
+	}
+	return result
+}
+
+// getDeviceProfile learn device preferences from recent likes, empty profile for unknown device.
+// Accepted distance comes from distances at swipe time, the device could be anywhere now
+func getDeviceProfile(deviceId string) (deviceProfile, error) {
+	if deviceId == "" {
+		return buildDeviceProfile(nil, nil, nil), nil
+	}
+	ratedPlaces, likes, swipeDistances, err := Dao.PlacesDB.GetRatedPlacesForDevice(deviceId, rankingHistorySize)
+	if err != nil {
+		return buildDeviceProfile(nil, nil, nil), err
+	}
+	profile := buildDeviceProfile(ratedPlaces, likes, swipeDistances)
+	log.WithFields(log.Fields{
+		"deviceId":         deviceId,
+		"ratedPlaces":      len(ratedPlaces),
+		"acceptedDistance": profile.acceptedDistance,
+	}).Info("Built device profile")
+	return profile, nil
+}
+
+// buildDeviceProfile preferences from rated places, likes are true for liked places,
+// swipeDistances are distances to places when they were swiped
+func buildDeviceProfile(ratedPlaces []dao.PlaceDB, likes map[uint]bool, swipeDistances map[uint]float64) deviceProfile {
+	profile := deviceProfile{
+		typeAffinity:     make(map[string]float64),
+		priceAffinity:    make(map[int]float64),
+		acceptedDistance: defaultAcceptedDistance,
+	}
+	typeVotes := make(map[string][]float64)
+	priceVotes := make(map[int][]float64)
+	var likedDistances []float64
+	for _, p := range ratedPlaces {
+		vote := -1.0
+		if likes[p.Id] {
+			vote = 1.0
+			distance, known := swipeDistances[p.Id]
+			if known && distance <= maxAcceptedDistance {
+				likedDistances = append(likedDistances, distance)
+			}
+		}
+		for _, t := range p.Types {
+			if !genericPlaceTypes[t] {
+				typeVotes[t] = append(typeVotes[t], vote)
+			}
+		}
+		if p.PriceLevel.Valid {
+			priceVotes[int(p.PriceLevel.Int32)] = append(priceVotes[int(p.PriceLevel.Int32)], vote)
+		}
+	}
+	for t, votes := range typeVotes {
+		profile.typeAffinity[t] = mean(votes)
+	}
+	for price, votes := range priceVotes {
+		profile.priceAffinity[price] = mean(votes)
+	}
+	if len(likedDistances) > 0 {
+		sort.Float64s(likedDistances)
+		profile.acceptedDistance = math.Max(likedDistances[len(likedDistances)/2], 1)
+	}
+	return profile
+}
+
+// preference how much place matches device preferences, from 0 to 1, 0.5 when nothing is known
+func (profile deviceProfile) preference(place dao.PlaceDB) float64 {
+	var affinities []float64
+	for _, t := range place.Types {
+		if affinity, ok := profile.typeAffinity[t]; ok {
+			affinities = append(affinities, affinity)
+		}
+	}
+	if place.PriceLevel.Valid {
+		if affinity, ok := profile.priceAffinity[int(place.PriceLevel.Int32)]; ok {
+			affinities = append(affinities, affinity)
+		}
+	}
+	if len(affinities) == 0 {
+		return 0.5
+	}
+	return (mean(affinities) + 1) / 2
+}
+
+// getPopularity share of likes with a prior of one like and one dislike, so few votes don't dominate
+func getPopularity(count dao.LikeCount) float64 {
+	return float64(count.Likes+1) / float64(count.Likes+count.Dislikes+2)
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+
+	"hungries-api/dao"
+)
+
+func rankingPlace(id uint, price int, types ...string) dao.PlaceDB {
+	return dao.PlaceDB{
+		Id:         id,
+		Types:      types,
+		PriceLevel: sql.NullInt32{Int32: int32(price), Valid: price >= 0},
+	}
+}
+
+func testDeviceProfile() deviceProfile {
+	ratedPlaces := []dao.PlaceDB{
+		rankingPlace(1, 2, "italian_restaurant", "restaurant", "food"),
+		rankingPlace(2, 2, "italian_restaurant", "restaurant"),
+		rankingPlace(3, 4, "bar"),
+		rankingPlace(4, 1, "restaurant"),
+	}
+	likes := map[uint]bool{1: true, 2: true, 3: false, 4: true}
+	// the last like was swiped in another city
+	swipeDistances := map[uint]float64{1: 800, 2: 1200, 3: 100, 4: 50000}
+	return buildDeviceProfile(ratedPlaces, likes, swipeDistances)
+}
+
+func TestBuildDeviceProfile(t *testing.T) {
+	profile := testDeviceProfile()
+	if profile.acceptedDistance != 1200 {
+		t.Fatalf("got accepted distance %v, want median of nearby liked places 1200", profile.acceptedDistance)
+	}
+	wantTypes := map[string]float64{"italian_restaurant": 1, "restaurant": 1, "bar": -1}
+	if len(profile.typeAffinity) != len(wantTypes) {
+		t.Fatalf("got type affinity %v, want %v", profile.typeAffinity, wantTypes)
+	}
+	for placeType, affinity := range wantTypes {
+		if profile.typeAffinity[placeType] != affinity {
+			t.Fatalf("got type affinity %v, want %v", profile.typeAffinity, wantTypes)
+		}
+	}
+	wantPrices := map[int]float64{1: 1, 2: 1, 4: -1}
+	for price, affinity := range wantPrices {
+		if profile.priceAffinity[price] != affinity {
+			t.Fatalf("got price affinity %v, want %v", profile.priceAffinity, wantPrices)
+		}
+	}
+
+	empty := buildDeviceProfile(nil, nil, nil)
+	if empty.acceptedDistance != defaultAcceptedDistance || len(empty.typeAffinity) != 0 {
+		t.Fatalf("got profile %+v without history", empty)
+	}
+}
+
+func TestDeviceProfileRank(t *testing.T) {
+	profile := testDeviceProfile()
+	tests := []struct {
+		name      string
+		profile   deviceProfile
+		place     dao.PlaceDB
+		distance  float64
+		likeCount dao.LikeCount
+		score     float64
+	}{
+		// 0.5*0.5 + 0.2*0.5 + 0.3*1
+		{"nothing known", profile, rankingPlace(10, -1, "cafe"), 0, dao.LikeCount{}, 0.65},
+		// 0.5*1 + 0.2*9/10 + 0.3*e^-1
+		{"liked type and price at accepted distance", profile, rankingPlace(11, 2, "italian_restaurant"), 1200, dao.LikeCount{Likes: 8}, 0.790364},
+		// 0.5*0 + 0.2*0.5 + 0.3*1
+		{"disliked type and price", profile, rankingPlace(12, 4, "bar"), 0, dao.LikeCount{}, 0.4},
+		// 0.5*0.5 + 0.2*0.5 + 0.3*1, liked type and disliked price cancel out
+		{"mixed preferences", profile, rankingPlace(13, 4, "restaurant"), 0, dao.LikeCount{}, 0.65},
+		// 0.5*0.5 + 0.2*2/6 + 0.3*e^-1
+		{"no history", buildDeviceProfile(nil, nil, nil), rankingPlace(14, 2, "restaurant"), 1000, dao.LikeCount{Likes: 1, Dislikes: 3}, 0.427030},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ranked := test.profile.rank(test.place, test.distance, test.likeCount)
+			if math.Abs(ranked.score-test.score) > 1e-6 {
+				t.Fatalf("got score %.6f, want %.6f", ranked.score, test.score)
+			}
+		})
+	}
+}
+
+func TestSortRanked(t *testing.T) {
+	ranked := func() []rankedPlace {
+		return []rankedPlace{
+			{place: dao.PlaceDB{Id: 1}, score: 0.5, popularity: 0.9, distance: 300},
+			{place: dao.PlaceDB{Id: 2}, score: 0.8, popularity: 0.5, distance: 200},
+			{place: dao.PlaceDB{Id: 3}, score: 0.6, popularity: 0.7, distance: 100},
+		}
+	}
+	tests := map[string][]uint{
+		SortRelevance:  {2, 3, 1},
+		SortDistance:   {3, 2, 1},
+		SortPopularity: {1, 3, 2},
+	}
+	for sortBy, want := range tests {
+		t.Run(sortBy, func(t *testing.T) {
+			places := sortRanked(ranked(), sortBy)
+			for i, id := range want {
+				if places[i].Id != id {
+					t.Fatalf("got place %d at %d, want %d", places[i].Id, i, id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"hungries-api/dao"
+)
+
+// how often idle buckets are forgotten
+const rateLimitCleanupInterval = 10 * time.Minute
+
+// buckets idle for that long are full again, day budget of maps api takes the longest to refill
+const rateLimitMaxIdle = 25 * time.Hour
+
+// RateLimit token bucket refilled with PerMinute tokens a minute, up to PerMinute tokens. Zero means no limit
+type RateLimit struct {
+	PerMinute float64
+}
+
+func (l RateLimit) ratePerSecond() float64 {
+	return l.PerMinute / 60
+}
+
+// RateLimitBackend keeps state of token buckets
+type RateLimitBackend interface {
+	// TakeToken take one token from the bucket, false if it's empty
+	TakeToken(key string, ratePerSecond float64, burst float64) (bool, error)
+	// ReturnToken put back a token taken for a call that didn't happen
+	ReturnToken(key string, burst float64) error
+	// DeleteIdleBuckets forget buckets that are full again after being idle
+	DeleteIdleBuckets(maxIdle time.Duration) error
+}
+
+// RateLimiter limits requests of API clients and devices
+type RateLimiter struct {
+	Backend RateLimitBackend
+	Client  RateLimit
+	Device  RateLimit
+}
+
+// Allow take tokens of the client and the device, device is ignored when it's empty.
+// clientKey is the client name, apps sharing legacy credentials get a key of their own
+func (l *RateLimiter) Allow(clientKey string, deviceId string) (bool, error) {
+	isAllowed, err := takeRateLimitToken(l.Backend, "client:"+clientKey, l.Client)
+	if err != nil || !isAllowed || deviceId == "" {
+		return isAllowed, err
+	}
+	return takeRateLimitToken(l.Backend, "device:"+deviceId, l.Device)
+}
+
+// RetryAfter seconds until the slowest bucket gets a token again
+func (l *RateLimiter) RetryAfter() string {
+	rate := math.Min(nonZero(l.Client.ratePerSecond()), nonZero(l.Device.ratePerSecond()))
+	return strconv.Itoa(int(math.Ceil(1 / rate)))
+}
+
+func nonZero(rate float64) float64 {
+	if rate == 0 {
+		return math.Inf(1)
+	}
+	return rate
+}
+
+func takeRateLimitToken(backend RateLimitBackend, key string, limit RateLimit) (bool, error) {
+	if limit.PerMinute <= 0 {
+		return true, nil
+	}
+	return backend.TakeToken(key, limit.ratePerSecond(), limit.PerMinute)
+}
+
+// StartRateLimitCleanup forget idle buckets in background, buckets idle for maxIdle are full again
+func StartRateLimitCleanup(backend RateLimitBackend, maxIdle time.Duration) {
+	go func() {
+		for range time.Tick(rateLimitCleanupInterval) {
+			backend.DeleteIdleBuckets(maxIdle)
+		}
+	}()
+}
+
+// initRateLimitBackend create rate limit backend by name
+func initRateLimitBackend(name string) (RateLimitBackend, error) {
+	switch name {
+	case "local":
+		return &LocalRateLimitBackend{}, nil
+	case "postgres":
+		return &PostgresRateLimitBackend{RateLimits: &dao.RateLimitDBService{DB: db}}, nil
+	default:
+		return nil, errors.New("unknown rate limit backend " + name)
+	}
+}
+
+// LocalRateLimitBackend buckets of this API instance only
+type LocalRateLimitBackend struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	// now current time, time.Now when it's nil
+	now func() time.Time
+}
+
+type tokenBucket struct {
+	tokens     float64
+	updateDate time.Time
+}
+
+func (b *LocalRateLimitBackend) TakeToken(key string, ratePerSecond float64, burst float64) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.buckets == nil {
+		b.buckets = make(map[string]*tokenBucket)
+	}
+	now := b.currentTime()
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, updateDate: now}
+		b.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updateDate).Seconds()*ratePerSecond)
+	bucket.updateDate = now
+	if bucket.tokens < 1 {
+		return false, nil
+	}
+	bucket.tokens--
+	return true, nil
+}
+
+func (b *LocalRateLimitBackend) currentTime() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+func (b *LocalRateLimitBackend) ReturnToken(key string, burst float64) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if bucket, ok := b.buckets[key]; ok {
+		bucket.tokens = math.Min(burst, bucket.tokens+1)
+	}
+	return nil
+}
+
+func (b *LocalRateLimitBackend) DeleteIdleBuckets(maxIdle time.Duration) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for key, bucket := range b.buckets {
+		if b.currentTime().Sub(bucket.updateDate) > maxIdle {
+			delete(b.buckets, key)
+		}
+	}
+	return nil
+}
+
+// PostgresRateLimitBackend buckets shared by all API instances
+type PostgresRateLimitBackend struct {
+	RateLimits *dao.RateLimitDBService
+}
+
+func (b *PostgresRateLimitBackend) TakeToken(key string, ratePerSecond float64, burst float64) (bool, error) {
+	return b.RateLimits.TakeToken(key, ratePerSecond, burst)
+}
+
+func (b *PostgresRateLimitBackend) ReturnToken(key string, burst float64) error {
+	return b.RateLimits.ReturnToken(key, burst)
+}
+
+func (b *PostgresRateLimitBackend) DeleteIdleBuckets(maxIdle time.Duration) error {
+	return b.RateLimits.DeleteIdleBuckets(maxIdle.Seconds())
+}
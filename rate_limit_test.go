@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testClock time that moves only when the test advances it
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestRateLimitBackend() (*LocalRateLimitBackend, *testClock) {
+	clock := &testClock{now: time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)}
+	return &LocalRateLimitBackend{now: clock.Now}, clock
+}
+
+func takeTokens(t *testing.T, backend RateLimitBackend, key string, ratePerSecond float64, burst float64, count int) int {
+	t.Helper()
+	taken := 0
+	for i := 0; i < count; i++ {
+		isAllowed, err := backend.TakeToken(key, ratePerSecond, burst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isAllowed {
+			taken++
+		}
+	}
+	return taken
+}
+
+func TestLocalRateLimitBackendRefill(t *testing.T) {
+	backend, clock := newTestRateLimitBackend()
+	// 60 a minute with burst of 60
+	if taken := takeTokens(t, backend, "device:a", 1, 60, 100); taken != 60 {
+		t.Fatalf("took %d tokens of full bucket, want 60", taken)
+	}
+	clock.Advance(10 * time.Second)
+	if taken := takeTokens(t, backend, "device:a", 1, 60, 100); taken != 10 {
+		t.Fatalf("took %d tokens after 10 seconds, want 10", taken)
+	}
+	clock.Advance(time.Hour)
+	if taken := takeTokens(t, backend, "device:a", 1, 60, 100); taken != 60 {
+		t.Fatalf("took %d tokens after an hour, want burst of 60", taken)
+	}
+	if taken := takeTokens(t, backend, "device:b", 1, 60, 1); taken != 1 {
+		t.Fatal("other bucket is empty")
+	}
+}
+
+func TestLocalRateLimitBackendReturnToken(t *testing.T) {
+	backend, _ := newTestRateLimitBackend()
+	takeTokens(t, backend, "key", 1, 2, 2)
+	if err := backend.ReturnToken("key", 2); err != nil {
+		t.Fatal(err)
+	}
+	if taken := takeTokens(t, backend, "key", 1, 2, 2); taken != 1 {
+		t.Fatalf("took %d tokens after returning one, want 1", taken)
+	}
+	// full bucket doesn't go over burst
+	backend.ReturnToken("key", 2)
+	backend.ReturnToken("key", 2)
+	backend.ReturnToken("key", 2)
+	if taken := takeTokens(t, backend, "key", 1, 2, 5); taken != 2 {
+		t.Fatalf("took %d tokens, want burst of 2", taken)
+	}
+}
+
+func TestLocalRateLimitBackendDeleteIdleBuckets(t *testing.T) {
+	backend, clock := newTestRateLimitBackend()
+	takeTokens(t, backend, "idle", 1, 1, 1)
+	clock.Advance(time.Minute)
+	takeTokens(t, backend, "active", 1, 1, 1)
+	backend.DeleteIdleBuckets(30 * time.Second)
+	if _, ok := backend.buckets["idle"]; ok {
+		t.Fatal("idle bucket isn't deleted")
+	}
+	if _, ok := backend.buckets["active"]; !ok {
+		t.Fatal("active bucket is deleted")
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	backend, _ := newTestRateLimitBackend()
+	limiter := &RateLimiter{Backend: backend, Client: RateLimit{PerMinute: 3}, Device: RateLimit{PerMinute: 1}}
+	if isAllowed, _ := limiter.Allow("app", "a"); !isAllowed {
+		t.Fatal("first request of device is limited")
+	}
+	if isAllowed, _ := limiter.Allow("app", "a"); isAllowed {
+		t.Fatal("device is over its limit")
+	}
+	// request limited by device takes client token too
+	if isAllowed, _ := limiter.Allow("app", ""); !isAllowed {
+		t.Fatal("last request of client is limited")
+	}
+	if isAllowed, _ := limiter.Allow("app", ""); isAllowed {
+		t.Fatal("client is over its limit")
+	}
+	if isAllowed, _ := limiter.Allow("other app", ""); !isAllowed {
+		t.Fatal("other client is limited")
+	}
+	if retryAfter := limiter.RetryAfter(); retryAfter != "60" {
+		t.Fatalf("got Retry-After %s, want 60", retryAfter)
+	}
+}
+
+func TestRateLimitClientKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       string
+		client       string
+		deviceId     string
+		remoteAddr   string
+		forwardedFor string
+		key          string
+	}{
+		{"api key client", "", "app", "a", "10.0.0.1:1234", "", "app"},
+		{"legacy with device", "", legacyClientName, "a", "10.0.0.1:1234", "", legacyClientName + ":device:a"},
+		{"legacy by remote address", "", legacyClientName, "", "10.0.0.1:1234", "1.2.3.4", legacyClientName + ":ip:10.0.0.1"},
+		{"legacy behind load balancer", "X-Forwarded-For", legacyClientName, "", "10.0.0.1:1234", "6.6.6.6, 1.2.3.4", legacyClientName + ":ip:1.2.3.4"},
+		{"legacy without header", "X-Forwarded-For", legacyClientName, "", "10.0.0.1:1234", "", legacyClientName + ":ip:10.0.0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth := &ApiAuth{ClientIpHeader: test.header}
+			r := httptest.NewRequest("GET", "/places", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			if key := auth.rateLimitClientKey(test.client, test.deviceId, r); key != test.key {
+				t.Fatalf("got key %s, want %s", key, test.key)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+)
+
+const DefaultRecommendationsRadius = 5000
+const DefaultRecommendationsLimit = 20
+const MaxRecommendationsLimit = 100
+
+// StartRecommendationsJob refresh similarities of devices with changed likes right away and then every interval in background
+func StartRecommendationsJob(interval time.Duration) {
+	go func() {
+		for {
+			refreshRecommendations()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func refreshRecommendations() {
+	start := time.Now()
+	refreshed, err := Dao.RecommendationsDB.RefreshSimilarities()
+	if err != nil {
+		log.WithField("error", err).Error("Error refreshing user similarities")
+		return
+	}
+	if refreshed < 0 {
+		log.Info("User similarities are being refreshed by another instance")
+		return
+	}
+	log.WithFields(log.Fields{
+		"users":    refreshed,
+		"duration": time.Since(start),
+	}).Info("Refreshed user similarities")
+}
+
+// FindRecommendedPlaces get places around coordinates liked by devices with similar taste
+func FindRecommendedPlaces(deviceId string, coordinates maps.LatLng, radius uint, limit uint) (PlacesResponse, error) {
+	log.WithFields(log.Fields{
+		"deviceId":    deviceId,
+		"coordinates": coordinates,
+		"radius":      radius,
+	}).Info("Getting recommended places")
+	placesDb, scores, err := Dao.RecommendationsDB.GetRecommendations(deviceId, coordinates.Lat, coordinates.Lng, radius, limit)
+	if err != nil {
+		return PlacesResponse{}, err
+	}
+	places := placeDBtoResponse(placesDb, map[uint]bool{}, coordinates)
+	for i := range places {
+		score := scores[places[i].Id]
+		places[i].Score = &score
+	}
+	return PlacesResponse{Places: places}, nil
+}
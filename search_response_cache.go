@@ -0,0 +1,196 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+// how often expired search responses are deleted
+const searchResponseCleanupInterval = 10 * time.Minute
+
+// Maps API page tokens stop working a few minutes after the search. Responses with a page token are cached
+// for half of that at most, so the token of a cached response is still valid for the other half
+const providerPageTokenLifetime = 4 * time.Minute
+
+// SearchResponseCache keeps nearby search responses of place provider
+type SearchResponseCache interface {
+	// Get get response by key, nil if it's not cached or expired
+	Get(key string) (*maps.PlacesSearchResponse, error)
+	// Save cache response by key for ttl
+	Save(key string, response maps.PlacesSearchResponse, ttl time.Duration) error
+	// DeleteExpired forget expired responses
+	DeleteExpired() error
+}
+
+// CachingPlaceProvider serves repeated nearby searches of the same area from cache without calling the provider.
+// Searches are keyed by geohash cell of the location, radius and filters, next pages by page token
+type CachingPlaceProvider struct {
+	Provider dao.PlaceProvider
+	Cache    SearchResponseCache
+	TTL      time.Duration
+}
+
+var _ dao.PlaceProvider = (*CachingPlaceProvider)(nil)
+
+func (p *CachingPlaceProvider) FindNearbyPlaces(coordinates maps.LatLng, radius uint, pageToken string, filter dao.SearchFilter) (maps.PlacesSearchResponse, error) {
+	key := searchResponseKey(coordinates, radius, pageToken, filter)
+	cached, err := p.Cache.Get(key)
+	if err == nil && cached != nil {
+		log.WithField("key", key).Info("Nearby search response found in cache")
+		return *cached, nil
+	}
+	response, err := p.Provider.FindNearbyPlaces(coordinates, radius, pageToken, filter)
+	if err != nil {
+		return response, err
+	}
+	p.Cache.Save(key, response, p.responseTTL(response))
+	return response, nil
+}
+
+// responseTTL how long the response is cached, responses with next page token live no longer than the token
+func (p *CachingPlaceProvider) responseTTL(response maps.PlacesSearchResponse) time.Duration {
+	if response.NextPageToken != "" && p.TTL > providerPageTokenLifetime/2 {
+		return providerPageTokenLifetime / 2
+	}
+	return p.TTL
+}
+
+func (p *CachingPlaceProvider) GetPlaceInfoFromMaps(placeId string, fields []maps.PlaceDetailsFieldMask) (maps.PlaceDetailsResult, error) {
+	return p.Provider.GetPlaceInfoFromMaps(placeId, fields)
+}
+
+func (p *CachingPlaceProvider) GetPhoto(photoReference string, width uint, height uint) (maps.PlacePhotoResponse, error) {
+	return p.Provider.GetPhoto(photoReference, width, height)
+}
+
+// searchResponseKey first page by snapped location, radius and filters, next pages by page token which
+// already belongs to one search
+func searchResponseKey(coordinates maps.LatLng, radius uint, pageToken string, filter dao.SearchFilter) string {
+	if pageToken != "" {
+		return "page:" + pageToken
+	}
+	cell := encodeGeohash(coordinates.Lat, coordinates.Lng, geohashPrecisionForRadius(radius))
+	return fmt.Sprintf("search:%s:%d:%s:%s:%t:%d:%d",
+		cell, radius, filter.Type, filter.Keyword, filter.OpenNow, filter.MinPrice, filter.MaxPrice)
+}
+
+// StartSearchResponseCleanup delete expired search responses in background
+func StartSearchResponseCleanup(cache SearchResponseCache) {
+	go func() {
+		for range time.Tick(searchResponseCleanupInterval) {
+			cache.DeleteExpired()
+		}
+	}()
+}
+
+// initSearchResponseCache create search response cache by name, nil when caching is disabled
+func initSearchResponseCache(name string, size int) (SearchResponseCache, error) {
+	switch name {
+	case "none":
+		return nil, nil
+	case "local":
+		return NewLocalSearchResponseCache(size), nil
+	case "postgres":
+		return &PostgresSearchResponseCache{SearchResponses: &dao.SearchResponseDBService{DB: db}}, nil
+	default:
+		return nil, errors.New("unknown search response cache " + name)
+	}
+}
+
+// LocalSearchResponseCache responses of this API instance only, least recently used ones are evicted over size
+type LocalSearchResponseCache struct {
+	size    int
+	mutex   sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type searchResponseEntry struct {
+	key        string
+	response   maps.PlacesSearchResponse
+	expireDate time.Time
+}
+
+func NewLocalSearchResponseCache(size int) *LocalSearchResponseCache {
+	return &LocalSearchResponseCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *LocalSearchResponseCache) Get(key string) (*maps.PlacesSearchResponse, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := element.Value.(*searchResponseEntry)
+	if time.Now().After(entry.expireDate) {
+		c.remove(element)
+		return nil, nil
+	}
+	c.order.MoveToFront(element)
+	response := entry.response
+	return &response, nil
+}
+
+func (c *LocalSearchResponseCache) Save(key string, response maps.PlacesSearchResponse, ttl time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	expireDate := time.Now().Add(ttl)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*searchResponseEntry)
+		entry.response = response
+		entry.expireDate = expireDate
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&searchResponseEntry{key: key, response: response, expireDate: expireDate})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *LocalSearchResponseCache) DeleteExpired() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	for _, element := range c.entries {
+		if now.After(element.Value.(*searchResponseEntry).expireDate) {
+			c.remove(element)
+		}
+	}
+	return nil
+}
+
+func (c *LocalSearchResponseCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*searchResponseEntry).key)
+}
+
+// PostgresSearchResponseCache responses shared by all API instances
+type PostgresSearchResponseCache struct {
+	SearchResponses *dao.SearchResponseDBService
+}
+
+func (c *PostgresSearchResponseCache) Get(key string) (*maps.PlacesSearchResponse, error) {
+	return c.SearchResponses.GetSearchResponse(key)
+}
+
+func (c *PostgresSearchResponseCache) Save(key string, response maps.PlacesSearchResponse, ttl time.Duration) error {
+	return c.SearchResponses.SaveSearchResponse(key, response, ttl.Seconds())
+}
+
+func (c *PostgresSearchResponseCache) DeleteExpired() error {
+	return c.SearchResponses.DeleteExpiredSearchResponses()
+}
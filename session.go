@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"googlemaps.github.io/maps"
+	"hungries-api/dao"
+)
+
+// a match needs at least two people
+const minSessionMatchLikes = 2
+
+var ErrSessionNotFound = errors.New("session not found")
+var ErrNotSessionMember = errors.New("device is not a session member")
+
+// CreateSession start new group swipe session around meeting point
+func CreateSession(deviceId string, coordinates maps.LatLng, radius uint, placeType maps.PlaceType, quorum uint) (SessionResponse, error) {
+	session, err := Dao.SessionsDB.CreateSession(dao.SessionDB{
+		Lat:       coordinates.Lat,
+		Lng:       coordinates.Lng,
+		Radius:    radius,
+		PlaceType: string(placeType),
+		Quorum:    quorum,
+	}, deviceId)
+	if err != nil {
+		return SessionResponse{}, err
+	}
+	return sessionToResponse(session, nil), nil
+}
+
+// JoinSession add device to session by code
+func JoinSession(code string, deviceId string) (SessionResponse, error) {
+	session, err := getSession(code)
+	if err != nil {
+		return SessionResponse{}, err
+	}
+	err = Dao.SessionsDB.AddMember(session.Id, deviceId)
+	if err != nil {
+		return SessionResponse{}, err
+	}
+	return GetSession(code)
+}
+
+// GetSession get session with matched places
+func GetSession(code string) (SessionResponse, error) {
+	session, err := getSession(code)
+	if err != nil {
+		return SessionResponse{}, err
+	}
+	matches, err := Dao.SessionsDB.GetMatchedPlaces(session.Id)
+	if err != nil {
+		return SessionResponse{}, err
+	}
+	return sessionToResponse(session, matches), nil
+}
+
+// FindSessionDeck get deck of places around session meeting point for session member
+func FindSessionDeck(code string, deviceId string, size int, cursor *pageCursor) (DeckResponse, error) {
+	session, err := getMemberSession(code, deviceId)
+	if err != nil {
+		return DeckResponse{}, err
+	}
+	filter := dao.DefaultSearchFilter()
+	filter.Type = maps.PlaceType(session.PlaceType)
+	coordinates := maps.LatLng{Lat: session.Lat, Lng: session.Lng}
+	if cursor == nil {
+		return FindDeck(coordinates, session.Radius, filter, deviceId, size, pageCursor{})
+	}
+	// cursor of another session or search
+	if !cursor.isSameSearch(coordinates, session.Radius, filter) {
+		return DeckResponse{}, ErrInvalidPageCursor
+	}
+	return FindDeck(coordinates, session.Radius, filter, deviceId, size, *cursor)
+}
+
+// SaveSessionLike save like or dislike of session member and check if it makes a match
+func SaveSessionLike(code string, placeId uint, deviceId string, isLiked bool) (SessionLikeResponse, error) {
+	session, err := getMemberSession(code, deviceId)
+	if err != nil {
+		return SessionLikeResponse{}, err
+	}
+	// members swipe places around the meeting point
+	err = Dao.LikesDB.SaveLike(deviceId, placeId, isLiked, &maps.LatLng{Lat: session.Lat, Lng: session.Lng})
+	if err != nil {
+		return SessionLikeResponse{}, err
+	}
+	err = Dao.SessionsDB.SaveSessionLike(session.Id, deviceId, placeId, isLiked)
+	if err != nil {
+		return SessionLikeResponse{}, err
+	}
+	if !isLiked {
+		return SessionLikeResponse{}, nil
+	}
+	members, err := Dao.SessionsDB.GetMembers(session.Id)
+	if err != nil {
+		return SessionLikeResponse{}, err
+	}
+	Events.Publish(Event{
+		Type:    EventSessionLike,
+		Session: session.Code,
+		PlaceId: placeId,
+	}, excludeString(members, deviceId))
+
+	// quorum can't be reached by fewer members than it requires, then all of them must like the place
+	requiredLikes := session.Quorum
+	if requiredLikes == 0 || requiredLikes > session.MemberCount {
+		requiredLikes = session.MemberCount
+	}
+	if requiredLikes < minSessionMatchLikes {
+		return SessionLikeResponse{}, nil
+	}
+	isMatch, err := Dao.SessionsDB.SaveMatchIfReached(session.Id, placeId, requiredLikes)
+	if err != nil || !isMatch {
+		return SessionLikeResponse{}, err
+	}
+	log.WithFields(log.Fields{
+		"session": session.Code,
+		"placeId": placeId,
+	}).Info("Swipe session match")
+	place, err := Dao.PlacesDB.GetPlaceById(placeId)
+	if err != nil {
+		return SessionLikeResponse{}, err
+	}
+	if place == nil {
+		return SessionLikeResponse{}, fmt.Errorf("matched place %d not found", placeId)
+	}
+	coordinates := maps.LatLng{Lat: session.Lat, Lng: session.Lng}
+	match := placeDBtoResponse([]dao.PlaceDB{*place}, map[uint]bool{}, coordinates)[0]
+	Events.Publish(Event{
+		Type:    EventMatch,
+		Session: session.Code,
+		PlaceId: placeId,
+	}, members)
+	return SessionLikeResponse{
+		IsMatch: true,
+		Match:   &match,
+	}, nil
+}
+
+func getSession(code string) (*dao.SessionDB, error) {
+	session, err := Dao.SessionsDB.GetSessionByCode(strings.ToUpper(code))
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func getMemberSession(code string, deviceId string) (*dao.SessionDB, error) {
+	session, err := getSession(code)
+	if err != nil {
+		return nil, err
+	}
+	isMember, err := Dao.SessionsDB.IsMember(session.Id, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotSessionMember
+	}
+	return session, nil
+}
+
+func sessionToResponse(session *dao.SessionDB, matches []dao.PlaceDB) SessionResponse {
+	coordinates := maps.LatLng{Lat: session.Lat, Lng: session.Lng}
+	return SessionResponse{
+		Code: session.Code,
+		Location: LocationResponse{
+			Latitude:  session.Lat,
+			Longitude: session.Lng,
+		},
+		Radius:      session.Radius,
+		PlaceType:   session.PlaceType,
+		Quorum:      session.Quorum,
+		MemberCount: session.MemberCount,
+		Matches:     placeDBtoResponse(matches, map[uint]bool{}, coordinates),
+	}
+}
+
+func excludeString(s []string, e string) []string {
+	var result []string
+	for _, a := range s {
+		if a != e {
+			result = append(result, a)
+		}
+	}
+	return result
+}